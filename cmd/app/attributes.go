@@ -0,0 +1,68 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/FaranushKarimov/crud/cmd/app/middleware"
+	"github.com/FaranushKarimov/crud/pkg/managers"
+	"github.com/FaranushKarimov/crud/pkg/types"
+)
+
+func (s *Server) handleManagerGetAttributes(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	items, err := s.managerSvc.Attributes(r.Context(), r.URL.Query().Get("category"))
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, items)
+}
+
+func (s *Server) handleManagerSaveAttribute(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	item := &managers.Attribute{}
+	err = json.NewDecoder(r.Body).Decode(&item)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err = s.managerSvc.SaveAttribute(r.Context(), item)
+	if err == types.ErrInvalidAttributes {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, item)
+}
@@ -0,0 +1,300 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/FaranushKarimov/crud/cmd/app/middleware"
+	"github.com/FaranushKarimov/crud/pkg/managers"
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/gorilla/mux"
+)
+
+//cartItemRequest ... товар и количество для корзины
+type cartItemRequest struct {
+	ProductID int64 `json:"product_id"`
+	Qty       int   `json:"qty"`
+}
+
+func (s *Server) handleCustomerGetCart(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	cart, err := s.customerSvc.Cart(r.Context(), id)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, cart)
+}
+
+func (s *Server) handleCustomerSetCartCurrency(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	var request struct {
+		Currency string `json:"currency"`
+	}
+	if err = json.NewDecoder(r.Body).Decode(&request); err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	cart, err := s.customerSvc.SetCartCurrency(r.Context(), id, request.Currency)
+	if err == types.ErrUnknownCurrency {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, cart)
+}
+
+func (s *Server) handleCustomerAddCartItem(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	var item cartItemRequest
+	if err = json.NewDecoder(r.Body).Decode(&item); err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	cart, err := s.customerSvc.AddCartItem(r.Context(), id, item.ProductID, item.Qty)
+	if err == types.ErrOutOfStock {
+		errorWriter(w, http.StatusConflict, err)
+		return
+	}
+	if err == types.ErrInvalidPosition || err == types.ErrUnknownCurrency || err == types.ErrNoExchangeRate {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, cart)
+}
+
+func (s *Server) handleCustomerUpdateCartItem(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	productID, err := strconv.ParseInt(mux.Vars(r)["productID"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var item cartItemRequest
+	if err = json.NewDecoder(r.Body).Decode(&item); err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	cart, err := s.customerSvc.UpdateCartItem(r.Context(), id, productID, item.Qty)
+	if err == types.ErrOutOfStock {
+		errorWriter(w, http.StatusConflict, err)
+		return
+	}
+	if err == types.ErrInvalidPosition || err == types.ErrUnknownCurrency || err == types.ErrNoExchangeRate {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, cart)
+}
+
+func (s *Server) handleCustomerRemoveCartItem(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	productID, err := strconv.ParseInt(mux.Vars(r)["productID"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	cart, err := s.customerSvc.RemoveCartItem(r.Context(), id, productID)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, cart)
+}
+
+//handleCustomerCheckout ... оформляет заказ только по корзине без изменений: если цены поменялись,
+//корзина запоминает новые цены и отвечаем 409, клиент смотрит корзину и оформляет повторно
+func (s *Server) handleCustomerCheckout(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	var request struct {
+		Coupon string `json:"coupon"`
+	}
+	if r.ContentLength != 0 {
+		if err = json.NewDecoder(r.Body).Decode(&request); err != nil {
+			//вызываем фукцию для ответа с ошибкой
+			errorWriter(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	sale, err := s.managerSvc.Checkout(r.Context(), id, request.Coupon)
+	if saleCustomerError(err) {
+		errorMessageWriter(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err == types.ErrCartEmpty {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if err == types.ErrCartChanged {
+		//клиент видит новые цены в корзине, повторное оформление пойдет уже по ним
+		if err = s.acceptChangedPrices(r.Context(), id); err != nil {
+			//вызываем фукцию для ответа с ошибкой
+			errorWriter(w, http.StatusInternalServerError, err)
+			return
+		}
+		errorWriter(w, http.StatusConflict, types.ErrCartChanged)
+		return
+	}
+	if err == types.ErrNoManagers {
+		errorWriter(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	if err == types.ErrInternal {
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondJSON(w, sale)
+}
+
+//handleManagerGetQueue ... заказы клиентов из корзины, которые ждут обработки у менеджера
+func (s *Server) handleManagerGetQueue(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	filter, err := salesFilterParams(r)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	filter.ManagerID, filter.Status, filter.Source = id, managers.SaleDraft, managers.SaleSourceCart
+
+	page, err := s.managerSvc.Sales(r.Context(), filter)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, page)
+}
+
+//acceptChangedPrices ... запоминает текущие цены корзины, если какие-то из них поменялись
+func (s *Server) acceptChangedPrices(ctx context.Context, customerID int64) error {
+	cart, err := s.customerSvc.Cart(ctx, customerID)
+	if err != nil {
+		return err
+	}
+	for _, item := range cart.Items {
+		if item.PriceChanged {
+			_, err = s.customerSvc.AcceptCartPrices(ctx, customerID)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/FaranushKarimov/crud/cmd/app/middleware"
+	"github.com/FaranushKarimov/crud/pkg/managers"
+	"github.com/FaranushKarimov/crud/pkg/types"
+)
+
+func (s *Server) handleManagerGetCoupons(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	items, err := s.managerSvc.Coupons(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, items)
+}
+
+func (s *Server) handleManagerCreateCoupons(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	batch := &managers.CouponBatch{}
+	err := json.NewDecoder(r.Body).Decode(&batch)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	items, err := s.managerSvc.CreateCoupons(r.Context(), batch)
+	if err == types.ErrInvalidCoupon {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if err == types.ErrCouponCodeUsed {
+		errorWriter(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, items)
+}
+
+func (s *Server) handleManagerGetCouponsReport(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	items, err := s.managerSvc.CouponsReport(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, items)
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/FaranushKarimov/crud/cmd/app/middleware"
+	"github.com/FaranushKarimov/crud/pkg/managers"
+	"github.com/FaranushKarimov/crud/pkg/types"
+)
+
+func (s *Server) handleManagerGetExchangeRates(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	items, err := s.managerSvc.ExchangeRates(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, items)
+}
+
+func (s *Server) handleManagerSaveExchangeRates(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	items := make([]*managers.ExchangeRate, 0)
+	err := json.NewDecoder(r.Body).Decode(&items)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	items, err = s.managerSvc.SaveExchangeRates(r.Context(), items)
+	if err == types.ErrUnknownCurrency {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, items)
+}
@@ -2,10 +2,13 @@ package app
 
 import (
 	"github.com/FaranushKarimov/crud/pkg/customers"
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/gorilla/mux"
 	"golang.org/x/crypto/bcrypt"
 
 	"encoding/json"
 	"net/http"
+	"strconv"
 )
 
 func (s *Server) handleCustomerRegistration(w http.ResponseWriter, r *http.Request) {
@@ -70,7 +73,11 @@ func (s *Server) handleCustomerGetToken(w http.ResponseWriter, r *http.Request)
 
 func (s *Server) handleCustomerGetProducts(w http.ResponseWriter, r *http.Request) {
 
-	items, err := s.customerSvc.Products(r.Context())
+	items, err := s.customerSvc.Products(r.Context(), r.URL.Query().Get("currency"))
+	if err == types.ErrUnknownCurrency {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
 		errorWriter(w, http.StatusBadRequest, err)
@@ -80,3 +87,30 @@ func (s *Server) handleCustomerGetProducts(w http.ResponseWriter, r *http.Reques
 	respondJSON(w, items)
 
 }
+
+func (s *Server) handleCustomerGetProductByID(w http.ResponseWriter, r *http.Request) {
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := s.customerSvc.ProductByID(r.Context(), id, r.URL.Query().Get("currency"))
+	if err == customers.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err == types.ErrUnknownCurrency || err == types.ErrNoExchangeRate {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, item)
+}
@@ -0,0 +1,249 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/FaranushKarimov/crud/cmd/app/middleware"
+	"github.com/FaranushKarimov/crud/pkg/managers"
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) handleManagerGetDepartments(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	items, err := s.managerSvc.Departments(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, items)
+}
+
+func (s *Server) handleManagerGetDepartmentByID(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	departmentID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := s.managerSvc.DepartmentByID(r.Context(), departmentID)
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, item)
+}
+
+func (s *Server) handleManagerSaveDepartment(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	item := &managers.Department{}
+	err := json.NewDecoder(r.Body).Decode(&item)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err = s.managerSvc.SaveDepartment(r.Context(), item)
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err == types.ErrInvalidDepartment {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if err == types.ErrDepartmentNameUsed {
+		errorMessageWriter(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, item)
+}
+
+func (s *Server) handleManagerAssignDepartment(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	managerID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var request struct {
+		DepartmentID int64 `json:"department_id"`
+	}
+	if err = json.NewDecoder(r.Body).Decode(&request); err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := s.managerSvc.AssignDepartment(r.Context(), managerID, request.DepartmentID)
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err == types.ErrInvalidDepartment {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, item)
+}
+
+func (s *Server) handleManagerGetDepartmentPlans(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	departmentID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	items, err := s.managerSvc.DepartmentPlans(r.Context(), departmentID)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, items)
+}
+
+func (s *Server) handleManagerSaveDepartmentPlan(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.adminID(w, r)
+	if !ok {
+		return
+	}
+
+	departmentID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	plan := &managers.DepartmentPlan{}
+	err = json.NewDecoder(r.Body).Decode(&plan)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	plan.DepartmentID = departmentID
+	plan.CreatedBy = id
+
+	plan, err = s.managerSvc.SaveDepartmentPlan(r.Context(), plan)
+	if err == types.ErrInvalidPlan {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, plan)
+}
+
+//handleManagerGetDepartmentsReport ... продажи отделов за месяц ?period=2006-01 (по умолчанию текущий)
+func (s *Server) handleManagerGetDepartmentsReport(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	now := time.Now()
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = now.Format("2006-01")
+	}
+
+	items, err := s.managerSvc.DepartmentsProgress(r.Context(), period, now)
+	if err == types.ErrInvalidPlan {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, items)
+}
@@ -0,0 +1,35 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	errMissingIfMatch = errors.New("If-Match header is required")
+	errBadIfMatch     = errors.New("If-Match header must be a single version ETag")
+)
+
+//setETag ... ETag это просто версия записи в кавычках
+func setETag(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", `"`+strconv.FormatInt(version, 10)+`"`)
+}
+
+//ifMatchVersion ... извлекаем версию из заголовка If-Match (принимаем и слабый W/"N")
+func ifMatchVersion(r *http.Request) (int64, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" {
+		return 0, errMissingIfMatch
+	}
+	value = strings.TrimPrefix(value, "W/")
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return 0, errBadIfMatch
+	}
+	version, err := strconv.ParseInt(value[1:len(value)-1], 10, 64)
+	if err != nil || version <= 0 {
+		return 0, errBadIfMatch
+	}
+	return version, nil
+}
@@ -0,0 +1,171 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/FaranushKarimov/crud/cmd/app/middleware"
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/gorilla/mux"
+)
+
+//teamManagerID ... id менеджера из пути, если его команду можно смотреть: админу - любую,
+//остальным - свою и команды своих подчиненных
+func (s *Server) teamManagerID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return 0, false
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return 0, false
+	}
+
+	managerID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return 0, false
+	}
+	if managerID == id || s.managerSvc.IsAdmin(r.Context(), id) {
+		return managerID, true
+	}
+
+	allowed, err := s.managerSvc.IsSubordinate(r.Context(), id, managerID)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return 0, false
+	}
+	if !allowed {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return 0, false
+	}
+	return managerID, true
+}
+
+func (s *Server) handleManagerSetBoss(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	managerID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var request struct {
+		BossID int64 `json:"boss_id"`
+	}
+	if err = json.NewDecoder(r.Body).Decode(&request); err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := s.managerSvc.SetBoss(r.Context(), managerID, request.BossID)
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err == types.ErrInvalidBoss || err == types.ErrHierarchyCycle {
+		errorMessageWriter(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, item)
+}
+
+func (s *Server) handleManagerGetSubordinates(w http.ResponseWriter, r *http.Request) {
+	managerID, ok := s.teamManagerID(w, r)
+	if !ok {
+		return
+	}
+
+	direct := r.URL.Query().Get("direct") == "true"
+	items, err := s.managerSvc.Subordinates(r.Context(), managerID, direct)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, items)
+}
+
+func (s *Server) handleManagerGetTeamSales(w http.ResponseWriter, r *http.Request) {
+	managerID, ok := s.teamManagerID(w, r)
+	if !ok {
+		return
+	}
+
+	from, to, err := periodParams(r)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	team, err := s.managerSvc.TeamSales(r.Context(), managerID, from, to)
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, team)
+}
+
+//handleManagerGetOrgChart ... дерево оргструктуры, ?root=id - только ветка этого менеджера
+func (s *Server) handleManagerGetOrgChart(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	var rootID int64
+	if value := r.URL.Query().Get("root"); value != "" {
+		rootID, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || rootID <= 0 {
+			//вызываем фукцию для ответа с ошибкой
+			errorWriter(w, http.StatusBadRequest, errInvalidFilter)
+			return
+		}
+	}
+
+	items, err := s.managerSvc.OrgChart(r.Context(), rootID)
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, items)
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/FaranushKarimov/crud/cmd/app/middleware"
+	"github.com/FaranushKarimov/crud/pkg/managers"
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/gorilla/mux"
+)
+
+//handleManagerUploadImages ... multipart/form-data, файлы в поле image (можно несколько)
+func (s *Server) handleManagerUploadImages(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	productID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 4*managers.MaxImageSize)
+	if err = r.ParseMultipartForm(managers.MaxImageSize); err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	files := r.MultipartForm.File["image"]
+	if len(files) == 0 {
+		errorWriter(w, http.StatusBadRequest, types.ErrInvalidImage)
+		return
+	}
+
+	items := make([]*managers.Image, 0, len(files))
+	for _, header := range files {
+		if header.Size > managers.MaxImageSize {
+			errorWriter(w, http.StatusRequestEntityTooLarge, types.ErrInvalidImage)
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			//вызываем фукцию для ответа с ошибкой
+			errorWriter(w, http.StatusBadRequest, err)
+			return
+		}
+		data, err := ioutil.ReadAll(file)
+		file.Close()
+		if err != nil {
+			//вызываем фукцию для ответа с ошибкой
+			errorWriter(w, http.StatusBadRequest, err)
+			return
+		}
+
+		item, err := s.managerSvc.UploadImage(r.Context(), productID, data)
+		if err == types.ErrNotFound {
+			errorWriter(w, http.StatusNotFound, err)
+			return
+		}
+		if err == types.ErrInvalidImage {
+			errorWriter(w, http.StatusUnsupportedMediaType, err)
+			return
+		}
+		if err != nil {
+			//вызываем фукцию для ответа с ошибкой
+			errorWriter(w, http.StatusInternalServerError, err)
+			return
+		}
+		items = append(items, item)
+	}
+
+	respondJSON(w, items)
+}
+
+func (s *Server) handleManagerRemoveImage(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	productID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	imageID, err := strconv.ParseInt(mux.Vars(r)["imageID"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = s.managerSvc.RemoveImage(r.Context(), productID, imageID)
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+}
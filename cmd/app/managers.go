@@ -9,12 +9,16 @@ import (
 
 	"github.com/FaranushKarimov/crud/cmd/app/middleware"
 	"github.com/FaranushKarimov/crud/pkg/managers"
+	"github.com/FaranushKarimov/crud/pkg/types"
 	"github.com/gorilla/mux"
 )
 
 //ADMIN ...
 const ADMIN = "ADMIN"
 
+//PriceOverride ... роль с правом продавать по ручной цене
+const PriceOverride = "PRICE_OVERRIDE"
+
 func (s *Server) handleManagerRegistration(w http.ResponseWriter, r *http.Request) {
 
 	id, err := middleware.Authentication(r.Context())
@@ -56,9 +60,11 @@ func (s *Server) handleManagerRegistration(w http.ResponseWriter, r *http.Reques
 	}
 
 	for _, role := range regItem.Roles {
-		if role == ADMIN {
+		switch role {
+		case ADMIN:
 			item.IsAdmin = true
-			break
+		case PriceOverride:
+			item.PriceOverride = true
 		}
 	}
 
@@ -116,17 +122,45 @@ func (s *Server) handleManagerChangeProducts(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	//для обновления существующего товара обязателен If-Match с его текущей версией
+	if product.ID != 0 {
+		product.Version, err = ifMatchVersion(r)
+		if err == errMissingIfMatch {
+			errorWriter(w, http.StatusPreconditionRequired, err)
+			return
+		}
+		if err != nil {
+			errorWriter(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
 	product, err = s.managerSvc.SaveProduct(r.Context(), product)
+	var conflict *types.ConflictError
+	if errors.As(err, &conflict) {
+		setETag(w, conflict.Version)
+		errorWriter(w, http.StatusPreconditionFailed, err)
+		return
+	}
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err == types.ErrUnknownCurrency || err == types.ErrCurrencyMismatch || err == types.ErrInvalidAttributes {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
 		errorWriter(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	setETag(w, product.Version)
 	respondJSON(w, product)
 }
 
-func (s *Server) handleManagerMakeSales(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleManagerGetProductByID(w http.ResponseWriter, r *http.Request) {
 	id, err := middleware.Authentication(r.Context())
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
@@ -138,17 +172,65 @@ func (s *Server) handleManagerMakeSales(w http.ResponseWriter, r *http.Request)
 		errorWriter(w, http.StatusForbidden, err)
 		return
 	}
-	sale := &managers.Sale{}
-	sale.ManagerID = id
-	err = json.NewDecoder(r.Body).Decode(&sale)
 
+	productID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	product, err := s.managerSvc.ProductByID(r.Context(), productID)
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
 		errorWriter(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	setETag(w, product.Version)
+	respondJSON(w, product)
+}
+
+func (s *Server) handleManagerMakeSales(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+	sale, err := decodeSale(r, id)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
 	sale, err = s.managerSvc.MakeSale(r.Context(), sale)
+	if saleCustomerError(err) {
+		errorMessageWriter(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err == types.ErrOutOfStock {
+		errorWriter(w, http.StatusConflict, err)
+		return
+	}
+	if err == types.ErrOverrideForbidden {
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+	if err == types.ErrInternal {
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
 		errorWriter(w, http.StatusBadRequest, err)
@@ -255,6 +337,10 @@ func (s *Server) handleManagerRemoveCustomerByID(w http.ResponseWriter, r *http.
 		return
 	}
 	err = s.managerSvc.RemoveCustomerByID(r.Context(), customerID)
+	if err == types.ErrCustomerInUse {
+		errorMessageWriter(w, http.StatusConflict, err)
+		return
+	}
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
 		errorWriter(w, http.StatusBadRequest, err)
@@ -308,13 +394,69 @@ func (s *Server) handleManagerChangeCustomer(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	customer.Version, err = ifMatchVersion(r)
+	if err == errMissingIfMatch {
+		errorWriter(w, http.StatusPreconditionRequired, err)
+		return
+	}
+	if err != nil {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
 	customer, err = s.managerSvc.ChangeCustomer(r.Context(), customer)
+	var conflict *types.ConflictError
+	if errors.As(err, &conflict) {
+		setETag(w, conflict.Version)
+		errorWriter(w, http.StatusPreconditionFailed, err)
+		return
+	}
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
 	if err != nil {
 		//вызываем фукцию для ответа с ошибкой
 		errorWriter(w, http.StatusBadRequest, err)
 		return
 	}
 
+	setETag(w, customer.Version)
 	respondJSON(w, customer)
 
 }
+
+func (s *Server) handleManagerGetCustomerByID(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	customerID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	customer, err := s.managerSvc.CustomerByID(r.Context(), customerID)
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	setETag(w, customer.Version)
+	respondJSON(w, customer)
+}
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/types"
+)
+
+//IdempotencyWindow ... сколько хранится ответ на запрос с Idempotency-Key
+const IdempotencyWindow = 24 * time.Hour
+
+//IdempotencyStore ... хранилище ключей и ответов (см. managers.Service)
+type IdempotencyStore interface {
+	ClaimIdempotencyKey(ctx context.Context, owner int64, key, hash string, window time.Duration) (*types.StoredResponse, error)
+	SaveIdempotentResponse(ctx context.Context, owner int64, key string, response *types.StoredResponse) error
+	ReleaseIdempotencyKey(ctx context.Context, owner int64, key string) error
+}
+
+//Idempotent ... POST с заголовком Idempotency-Key от авторизованного пользователя выполняется один раз:
+//повтор с тем же ключом и тем же запросом получает сохраненный ответ, с другим запросом - 409;
+//ответ сохраняется вместе с заголовками; после 5xx или паники в обработчике ключ освобождается, чтобы запрос можно было повторить
+func Idempotent(store IdempotencyStore, window time.Duration) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			key := request.Header.Get("Idempotency-Key")
+			owner, _ := Authentication(request.Context())
+			if request.Method != http.MethodPost || key == "" || owner == 0 {
+				handler.ServeHTTP(writer, request)
+				return
+			}
+			if len(key) > 255 {
+				http.Error(writer, "Idempotency-Key is too long", http.StatusBadRequest)
+				return
+			}
+
+			body, err := ioutil.ReadAll(request.Body)
+			if err != nil {
+				http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+			request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			sum := sha256.New()
+			sum.Write([]byte(request.Method + " " + request.URL.RequestURI() + "\n"))
+			sum.Write(body)
+			hash := hex.EncodeToString(sum.Sum(nil))
+
+			stored, err := store.ClaimIdempotencyKey(request.Context(), owner, key, hash, window)
+			if err == types.ErrIdempotencyMismatch || err == types.ErrIdempotencyInProgress {
+				http.Error(writer, err.Error(), http.StatusConflict)
+				return
+			}
+			if err != nil {
+				http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			if stored != nil {
+				for name, values := range stored.Header {
+					writer.Header()[name] = values
+				}
+				writer.Header().Set("Idempotent-Replayed", "true")
+				writer.WriteHeader(stored.Status)
+				_, err = writer.Write(stored.Body)
+				if err != nil {
+					log.Print(err)
+				}
+				return
+			}
+
+			//ответа после паники нет, освобождаем ключ и отдаем панику дальше
+			defer func() {
+				if e := recover(); e != nil {
+					releaseIdempotencyKey(store, owner, key)
+					panic(e)
+				}
+			}()
+
+			recorder := &responseRecorder{ResponseWriter: writer}
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.status == 0 {
+				recorder.WriteHeader(http.StatusOK)
+			}
+			if recorder.status >= 500 {
+				releaseIdempotencyKey(store, owner, key)
+				return
+			}
+
+			//клиент мог уже отвалиться (ради этого и нужен ключ), поэтому сохраняем не в контексте запроса
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err = store.SaveIdempotentResponse(ctx, owner, key, &types.StoredResponse{
+				Status: recorder.status,
+				Header: recorder.header,
+				Body:   recorder.body.Bytes(),
+			})
+			if err != nil {
+				log.Print(err)
+			}
+		})
+	}
+}
+
+//releaseIdempotencyKey ... освобождает ключ не в контексте запроса, он может быть уже отменен
+func releaseIdempotencyKey(store IdempotencyStore, owner int64, key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := store.ReleaseIdempotencyKey(ctx, owner, key)
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+//responseRecorder ... пишет ответ клиенту и запоминает его копию с заголовками на момент отправки
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	//повторный WriteHeader net/http игнорирует, запоминаем только первый
+	if r.status == 0 {
+		r.status = status
+		r.header = r.Header().Clone()
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/types"
+)
+
+type fakeEntry struct {
+	hash     string
+	response *types.StoredResponse
+}
+
+//fakeStore ... IdempotencyStore в памяти, без сроков хранения
+type fakeStore struct {
+	mu      sync.Mutex
+	entries map[string]*fakeEntry
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{entries: make(map[string]*fakeEntry)}
+}
+
+func (f *fakeStore) ClaimIdempotencyKey(ctx context.Context, owner int64, key, hash string, window time.Duration) (*types.StoredResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	entry, ok := f.entries[key]
+	if !ok {
+		f.entries[key] = &fakeEntry{hash: hash}
+		return nil, nil
+	}
+	if entry.hash != hash {
+		return nil, types.ErrIdempotencyMismatch
+	}
+	if entry.response == nil {
+		return nil, types.ErrIdempotencyInProgress
+	}
+	return entry.response, nil
+}
+
+func (f *fakeStore) SaveIdempotentResponse(ctx context.Context, owner int64, key string, response *types.StoredResponse) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries[key].response = response
+	return nil
+}
+
+func (f *fakeStore) ReleaseIdempotencyKey(ctx context.Context, owner int64, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if entry, ok := f.entries[key]; ok && entry.response == nil {
+		delete(f.entries, key)
+	}
+	return nil
+}
+
+func (f *fakeStore) has(key string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.entries[key]
+	return ok
+}
+
+func idempotentRequest(method, key, body string) *http.Request {
+	request := httptest.NewRequest(method, "/api/managers/sales", strings.NewReader(body))
+	request.Header.Set("Idempotency-Key", key)
+	return request.WithContext(context.WithValue(request.Context(), authenticationContextKey, int64(7)))
+}
+
+func serve(handler http.Handler, request *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestIdempotentReplaysResponseWithHeaders(t *testing.T) {
+	store := newFakeStore()
+	calls := 0
+	handler := Idempotent(store, IdempotencyWindow)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Location", "/api/managers/sales/42")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":42}`))
+	}))
+
+	first := serve(handler, idempotentRequest(http.MethodPost, "k1", `{"qty":1}`))
+	second := serve(handler, idempotentRequest(http.MethodPost, "k1", `{"qty":1}`))
+
+	if calls != 1 {
+		t.Fatalf("handler calls = %d, want 1", calls)
+	}
+	if second.Code != first.Code || second.Body.String() != first.Body.String() {
+		t.Errorf("replay = %d %q, want %d %q", second.Code, second.Body.String(), first.Code, first.Body.String())
+	}
+	for _, name := range []string{"Content-Type", "ETag", "Location"} {
+		if got, want := second.Header().Get(name), first.Header().Get(name); got != want {
+			t.Errorf("replayed %s = %q, want %q", name, got, want)
+		}
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("replay is not marked with Idempotent-Replayed")
+	}
+}
+
+func TestIdempotentRejectsOtherRequestWithSameKey(t *testing.T) {
+	store := newFakeStore()
+	calls := 0
+	handler := Idempotent(store, IdempotencyWindow)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+
+	serve(handler, idempotentRequest(http.MethodPost, "k1", `{"qty":1}`))
+	response := serve(handler, idempotentRequest(http.MethodPost, "k1", `{"qty":2}`))
+
+	if response.Code != http.StatusConflict {
+		t.Errorf("status = %d, want %d", response.Code, http.StatusConflict)
+	}
+	if calls != 1 {
+		t.Errorf("handler calls = %d, want 1", calls)
+	}
+}
+
+func TestIdempotentRejectsRequestInProgress(t *testing.T) {
+	store := newFakeStore()
+	var handler http.Handler
+	var inner *httptest.ResponseRecorder
+	handler = Idempotent(store, IdempotencyWindow)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//тот же запрос приходит повторно, пока первый еще выполняется
+		if inner == nil {
+			inner = serve(handler, idempotentRequest(http.MethodPost, "k1", `{"qty":1}`))
+		}
+	}))
+
+	serve(handler, idempotentRequest(http.MethodPost, "k1", `{"qty":1}`))
+
+	if inner == nil || inner.Code != http.StatusConflict {
+		t.Fatalf("concurrent request = %v, want status %d", inner, http.StatusConflict)
+	}
+}
+
+func TestIdempotentReleasesKeyOnServerError(t *testing.T) {
+	store := newFakeStore()
+	calls := 0
+	handler := Idempotent(store, IdempotencyWindow)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	first := serve(handler, idempotentRequest(http.MethodPost, "k1", `{"qty":1}`))
+	if first.Code != http.StatusInternalServerError || store.has("k1") {
+		t.Fatalf("after 5xx: status %d, key kept %v", first.Code, store.has("k1"))
+	}
+	second := serve(handler, idempotentRequest(http.MethodPost, "k1", `{"qty":1}`))
+	if second.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("retry = %d after %d calls, want %d after 2", second.Code, calls, http.StatusCreated)
+	}
+}
+
+func TestIdempotentReleasesKeyOnPanic(t *testing.T) {
+	store := newFakeStore()
+	handler := Idempotent(store, IdempotencyWindow)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic was not propagated")
+			}
+		}()
+		serve(handler, idempotentRequest(http.MethodPost, "k1", `{"qty":1}`))
+	}()
+
+	if store.has("k1") {
+		t.Error("key is still claimed after panic")
+	}
+}
+
+func TestIdempotentSkipsNonPost(t *testing.T) {
+	store := newFakeStore()
+	calls := 0
+	handler := Idempotent(store, IdempotencyWindow)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+
+	serve(handler, idempotentRequest(http.MethodGet, "k1", ""))
+	serve(handler, idempotentRequest(http.MethodGet, "k1", ""))
+
+	if calls != 2 || store.has("k1") {
+		t.Errorf("handler calls = %d, key claimed %v; want 2 calls and no claim", calls, store.has("k1"))
+	}
+}
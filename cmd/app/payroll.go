@@ -0,0 +1,229 @@
+package app
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/FaranushKarimov/crud/cmd/app/middleware"
+	"github.com/FaranushKarimov/crud/pkg/managers"
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/gorilla/mux"
+)
+
+//зарплаты и схемы комиссии видит и меняет только админ
+func (s *Server) adminID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return 0, false
+	}
+	if id == 0 || !s.managerSvc.IsAdmin(r.Context(), id) {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return 0, false
+	}
+	return id, true
+}
+
+func (s *Server) handleManagerGetCommissionSchemes(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	items, err := s.managerSvc.CommissionSchemes(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, items)
+}
+
+func (s *Server) handleManagerSaveCommissionScheme(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	item := &managers.CommissionScheme{}
+	err := json.NewDecoder(r.Body).Decode(&item)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err = s.managerSvc.SaveCommissionScheme(r.Context(), item)
+	if err == types.ErrInvalidCommission {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, item)
+}
+
+func (s *Server) handleManagerAssignCommission(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	var params struct {
+		ManagerID int64 `json:"manager_id"`
+		SchemeID  int64 `json:"scheme_id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = s.managerSvc.SetManagerCommission(r.Context(), params.ManagerID, params.SchemeID)
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondJSON(w, params)
+}
+
+func (s *Server) handleManagerGetPayrollRuns(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	items, err := s.managerSvc.PayrollRuns(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, items)
+}
+
+func (s *Server) handleManagerRunPayroll(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	var params struct {
+		Period string `json:"period"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	run, err := s.managerSvc.RunPayroll(r.Context(), params.Period)
+	if err == types.ErrInvalidPeriod {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if err == types.ErrPayrollLocked {
+		errorWriter(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, run)
+}
+
+func (s *Server) handleManagerLockPayroll(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.adminID(w, r)
+	if !ok {
+		return
+	}
+
+	runID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	run, err := s.managerSvc.LockPayroll(r.Context(), runID, id)
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err == types.ErrPayrollLocked {
+		errorWriter(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, run)
+}
+
+//handleManagerGetPayrollRun ... расчет со строками, format=csv для выгрузки
+func (s *Server) handleManagerGetPayrollRun(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	runID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	run, err := s.managerSvc.PayrollRun(r.Context(), runID)
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if r.URL.Query().Get("format") != "csv" {
+		respondJSON(w, run)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "payroll-"+run.Period+".csv"))
+	writer := csv.NewWriter(w)
+	records := [][]string{{"manager_id", "name", "scheme_id", "plan", "revenue", "salary", "commission", "total"}}
+	for _, line := range run.Lines {
+		records = append(records, []string{
+			strconv.FormatInt(line.ManagerID, 10), line.Name, strconv.FormatInt(line.SchemeID, 10), strconv.Itoa(line.Plan),
+			strconv.Itoa(line.Revenue), strconv.Itoa(line.Salary), strconv.Itoa(line.Commission), strconv.Itoa(line.Total),
+		})
+	}
+	if err = writer.WriteAll(records); err != nil {
+		log.Print(err)
+	}
+}
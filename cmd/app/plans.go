@@ -0,0 +1,126 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/FaranushKarimov/crud/cmd/app/middleware"
+	"github.com/FaranushKarimov/crud/pkg/managers"
+	"github.com/FaranushKarimov/crud/pkg/types"
+)
+
+func (s *Server) handleManagerSavePlan(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+	//планы задает только админ
+	if !s.managerSvc.IsAdmin(r.Context(), id) {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	plan := &managers.Plan{}
+	err = json.NewDecoder(r.Body).Decode(&plan)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	plan.CreatedBy = id
+
+	plan, err = s.managerSvc.SavePlan(r.Context(), plan)
+	if err == types.ErrInvalidPlan {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, plan)
+}
+
+//handleManagerGetPlans ... история планов менеджера из параметра manager (по умолчанию свои)
+func (s *Server) handleManagerGetPlans(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	managerID := id
+	if value := r.URL.Query().Get("manager"); value != "" {
+		managerID, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			//вызываем фукцию для ответа с ошибкой
+			errorWriter(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	items, err := s.managerSvc.Plans(r.Context(), managerID)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, items)
+}
+
+//handleManagerGetPlansProgress ... выполнение планов за месяц из параметра period (2006-01, по умолчанию текущий)
+func (s *Server) handleManagerGetPlansProgress(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	now := time.Now()
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = now.Format("2006-01")
+	}
+
+	report, err := s.managerSvc.PlansProgress(r.Context(), period, now)
+	if err == types.ErrInvalidPlan {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, report)
+}
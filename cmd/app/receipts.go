@@ -0,0 +1,107 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/FaranushKarimov/crud/cmd/app/middleware"
+	"github.com/FaranushKarimov/crud/pkg/managers"
+	"github.com/FaranushKarimov/crud/pkg/receipts"
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/gorilla/mux"
+)
+
+//handleManagerGetReceipt ... чек или счет по продаже: параметр kind (receipt или invoice, по умолчанию receipt)
+//и format (html или pdf, по умолчанию html)
+func (s *Server) handleManagerGetReceipt(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	saleID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	kind := r.URL.Query().Get("kind")
+	if kind == "" {
+		kind = managers.DocumentReceipt
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "html"
+	}
+	if format != "html" && format != "pdf" {
+		errorWriter(w, http.StatusBadRequest, types.ErrInvalidDocument)
+		return
+	}
+
+	document, err := s.managerSvc.IssueDocument(r.Context(), saleID, kind)
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err == types.ErrSaleStatus {
+		errorWriter(w, http.StatusConflict, err)
+		return
+	}
+	if err == types.ErrInvalidDocument {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	sale, err := s.managerSvc.SaleByID(r.Context(), saleID)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+	//покупателя может не быть в базе, тогда документ печатается без него
+	customer, err := s.managerSvc.CustomerByID(r.Context(), sale.CustomerID)
+	if err != nil && err != types.ErrNotFound {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	data := &receipts.Data{Shop: s.shop, Document: document, Sale: sale, Customer: customer}
+	buf := &bytes.Buffer{}
+	contentType := "text/html; charset=utf-8"
+	if format == "pdf" {
+		contentType = "application/pdf"
+		err = receipts.PDF(buf, data)
+	} else {
+		err = receipts.HTML(buf, data)
+	}
+	if err != nil {
+		log.Print(err)
+		errorWriter(w, http.StatusInternalServerError, types.ErrInternal)
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%06d.%s", document.Kind, document.Number, format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+	_, err = buf.WriteTo(w)
+	if err != nil {
+		log.Print(err)
+	}
+}
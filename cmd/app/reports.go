@@ -0,0 +1,78 @@
+package app
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/FaranushKarimov/crud/cmd/app/middleware"
+	"github.com/FaranushKarimov/crud/pkg/managers"
+	"github.com/FaranushKarimov/crud/pkg/types"
+)
+
+//handleManagerGetSalesReport ... параметры group (day, week, month, product, manager, department; по умолчанию day),
+//from и to как в periodParams, format (json или csv, по умолчанию json)
+func (s *Server) handleManagerGetSalesReport(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	from, to, err := periodParams(r)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	group := r.URL.Query().Get("group")
+	if group == "" {
+		group = managers.GroupDay
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		errorWriter(w, http.StatusBadRequest, types.ErrInvalidReport)
+		return
+	}
+
+	report, err := s.managerSvc.SalesReport(r.Context(), group, from, to)
+	if err == types.ErrInvalidReport {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if format != "csv" {
+		respondJSON(w, report)
+		return
+	}
+	filename := fmt.Sprintf("sales-%s-%s-%s.csv", group, from.Format("20060102"), to.AddDate(0, 0, -1).Format("20060102"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	writeReportCSV(w, report)
+}
+
+//это функция для вывода отчета в CSV, суммы в минимальных единицах базовой валюты
+func writeReportCSV(w http.ResponseWriter, report *managers.SalesReport) {
+	writer := csv.NewWriter(w)
+	records := [][]string{{"key", "name", "revenue", "units", "sales"}}
+	for _, row := range report.Rows {
+		records = append(records, []string{row.Key, row.Name, strconv.Itoa(row.Revenue), strconv.Itoa(row.Units), strconv.Itoa(row.Sales)})
+	}
+	records = append(records, []string{"total", "", strconv.Itoa(report.Total.Revenue), strconv.Itoa(report.Total.Units), strconv.Itoa(report.Total.Sales)})
+	if err := writer.WriteAll(records); err != nil {
+		log.Print(err)
+	}
+}
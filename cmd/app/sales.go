@@ -0,0 +1,404 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/FaranushKarimov/crud/cmd/app/middleware"
+	"github.com/FaranushKarimov/crud/pkg/managers"
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/gorilla/mux"
+)
+
+//errInvalidFilter ... неверный параметр фильтра
+var errInvalidFilter = errors.New("invalid filter")
+
+//decodeSale ... продажа из тела запроса; менеджер - всегда тот, кто авторизован,
+//manager_id из тела игнорируется (от него зависят право на ручную цену и override_by)
+func decodeSale(r *http.Request, managerID int64) (*managers.Sale, error) {
+	sale := &managers.Sale{}
+	if err := json.NewDecoder(r.Body).Decode(&sale); err != nil {
+		return nil, err
+	}
+	sale.ManagerID = managerID
+	return sale, nil
+}
+
+//saleCustomerError ... покупатель продажи не найден, неактивен или не указан - клиенту нужен текст ошибки
+func saleCustomerError(err error) bool {
+	return err == types.ErrCustomerRequired || err == types.ErrCustomerNotFound ||
+		err == types.ErrCustomerInactive || err == types.ErrAnonymousCustomer
+}
+
+func (s *Server) handleManagerListSales(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	filter, err := salesFilterParams(r)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := s.managerSvc.Sales(r.Context(), filter)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, page)
+}
+
+func (s *Server) handleManagerGetSaleByID(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	saleID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	sale, err := s.managerSvc.SaleByID(r.Context(), saleID)
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, sale)
+}
+
+//это функция для извлечения фильтра продаж из параметров manager, customer, product, status,
+//from и to (формат 2006-01-02, to включительно), limit и offset; все параметры необязательны
+func salesFilterParams(r *http.Request) (*managers.SalesFilter, error) {
+	query := r.URL.Query()
+	filter := &managers.SalesFilter{Status: query.Get("status"), Source: query.Get("source")}
+
+	ids := map[string]*int64{
+		"manager":  &filter.ManagerID,
+		"customer": &filter.CustomerID,
+		"product":  &filter.ProductID,
+	}
+	for name, target := range ids {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, errInvalidFilter
+		}
+		*target = id
+	}
+
+	if value := query.Get("from"); value != "" {
+		from, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return nil, errInvalidFilter
+		}
+		filter.From = &from
+	}
+	if value := query.Get("to"); value != "" {
+		to, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return nil, errInvalidFilter
+		}
+		to = to.AddDate(0, 0, 1)
+		filter.To = &to
+	}
+
+	pages := map[string]*int{
+		"limit":  &filter.Limit,
+		"offset": &filter.Offset,
+	}
+	for name, target := range pages {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, errInvalidFilter
+		}
+		*target = n
+	}
+
+	return filter, nil
+}
+
+func (s *Server) handleManagerMakeReturn(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	saleID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ret := &managers.Return{}
+	err = json.NewDecoder(r.Body).Decode(&ret)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	ret.SaleID = saleID
+	ret.ManagerID = id
+
+	ret, err = s.managerSvc.MakeReturn(r.Context(), ret)
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err == types.ErrReturnExceedsSold || err == types.ErrSaleStatus {
+		errorWriter(w, http.StatusConflict, err)
+		return
+	}
+	if err == types.ErrInvalidReturn {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if err == types.ErrAnonymousCustomer {
+		errorMessageWriter(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, ret)
+}
+
+func (s *Server) handleManagerGetReturns(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	saleID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	items, err := s.managerSvc.Returns(r.Context(), saleID)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, items)
+}
+
+func (s *Server) handleManagerUpdateSale(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	saleID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	sale, err := decodeSale(r, id)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	sale.ID = saleID
+
+	sale, err = s.managerSvc.UpdateSale(r.Context(), sale)
+	if saleCustomerError(err) {
+		errorMessageWriter(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err == types.ErrSaleStatus {
+		errorWriter(w, http.StatusConflict, err)
+		return
+	}
+	if err == types.ErrOverrideForbidden {
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+	if err == types.ErrInternal {
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondJSON(w, sale)
+}
+
+func (s *Server) handleManagerChangeSaleStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	saleID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var params struct {
+		Status string `json:"status"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	sale, err := s.managerSvc.ChangeSaleStatus(r.Context(), saleID, params.Status)
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err == types.ErrSaleStatus || err == types.ErrOutOfStock || err == types.ErrBalanceDue || err == types.ErrSaleHasPayments {
+		errorWriter(w, http.StatusConflict, err)
+		return
+	}
+	if err == types.ErrInternal {
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondJSON(w, sale)
+}
+
+func (s *Server) handleManagerAddPayments(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if id == 0 {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusForbidden, err)
+		return
+	}
+
+	saleID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var params struct {
+		Payments []*managers.Payment `json:"payments"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+
+	sale, err := s.managerSvc.AddPayments(r.Context(), saleID, id, params.Payments)
+	if err == types.ErrNotFound {
+		errorWriter(w, http.StatusNotFound, err)
+		return
+	}
+	if err == types.ErrSaleStatus || err == types.ErrOverpayment || err == types.ErrInsufficientCredit || err == types.ErrInsufficientPoints {
+		errorWriter(w, http.StatusConflict, err)
+		return
+	}
+	if err == types.ErrInvalidPayment {
+		errorWriter(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		//вызываем фукцию для ответа с ошибкой
+		errorWriter(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, sale)
+}
@@ -0,0 +1,31 @@
+package app
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeSaleIgnoresBodyManagerID(t *testing.T) {
+	body := `{"manager_id": 99, "customer_id": 5, "positions": [{"product_id": 1, "qty": 2}]}`
+	r := httptest.NewRequest("POST", "/api/managers/sales", strings.NewReader(body))
+
+	sale, err := decodeSale(r, 7)
+	if err != nil {
+		t.Fatalf("decodeSale: %v", err)
+	}
+	if sale.ManagerID != 7 {
+		t.Errorf("ManagerID = %d, want authenticated manager 7", sale.ManagerID)
+	}
+	if sale.CustomerID != 5 {
+		t.Errorf("CustomerID = %d, want 5", sale.CustomerID)
+	}
+}
+
+func TestDecodeSaleInvalidBody(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/managers/sales", strings.NewReader("{"))
+
+	if _, err := decodeSale(r, 7); err == nil {
+		t.Fatal("decodeSale: expected error for malformed body")
+	}
+}
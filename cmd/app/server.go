@@ -4,10 +4,13 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/FaranushKarimov/crud/cmd/app/middleware"
+	"github.com/FaranushKarimov/crud/pkg/blob"
 	"github.com/FaranushKarimov/crud/pkg/customers"
 	"github.com/FaranushKarimov/crud/pkg/managers"
+	"github.com/FaranushKarimov/crud/pkg/receipts"
 	"github.com/gorilla/mux"
 )
 
@@ -16,14 +19,18 @@ type Server struct {
 	mux         *mux.Router
 	customerSvc *customers.Service
 	managerSvc  *managers.Service
+	blobs       blob.Store
+	shop        *receipts.Shop
 }
 
 //NewServer ... создает новый сервер
-func NewServer(m *mux.Router, cSvc *customers.Service, mSvc *managers.Service) *Server {
+func NewServer(m *mux.Router, cSvc *customers.Service, mSvc *managers.Service, blobs blob.Store, shop *receipts.Shop) *Server {
 	return &Server{
 		mux:         m,
 		customerSvc: cSvc,
 		managerSvc:  mSvc,
+		blobs:       blobs,
+		shop:        shop,
 	}
 }
 
@@ -35,6 +42,11 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 //Init ... инициализация сервера
 func (s *Server) Init() {
 
+	//картинки из локального хранилища раздаем сами
+	if local, ok := s.blobs.(*blob.LocalStore); ok {
+		s.mux.PathPrefix(local.BaseURL() + "/").Handler(http.StripPrefix(local.BaseURL()+"/", local)).Methods("GET")
+	}
+
 	customersAuthenticateMd := middleware.Authenticate(s.customerSvc.IDByToken)
 	customersSubrouter := s.mux.PathPrefix("/api/customers").Subrouter()
 	customersSubrouter.Use(customersAuthenticateMd)
@@ -42,19 +54,80 @@ func (s *Server) Init() {
 	customersSubrouter.HandleFunc("", s.handleCustomerRegistration).Methods("POST")
 	customersSubrouter.HandleFunc("/token", s.handleCustomerGetToken).Methods("POST")
 	customersSubrouter.HandleFunc("/products", s.handleCustomerGetProducts).Methods("GET")
+	customersSubrouter.HandleFunc("/products/{id:[0-9]+}", s.handleCustomerGetProductByID).Methods("GET")
+	customersSubrouter.HandleFunc("/cart", s.handleCustomerGetCart).Methods("GET")
+	customersSubrouter.HandleFunc("/cart", s.handleCustomerSetCartCurrency).Methods("POST")
+	customersSubrouter.HandleFunc("/cart/items", s.handleCustomerAddCartItem).Methods("POST")
+	customersSubrouter.HandleFunc("/cart/items/{productID:[0-9]+}", s.handleCustomerUpdateCartItem).Methods("POST")
+	customersSubrouter.HandleFunc("/cart/items/{productID:[0-9]+}", s.handleCustomerRemoveCartItem).Methods("DELETE")
+	customersSubrouter.HandleFunc("/cart/checkout", s.handleCustomerCheckout).Methods("POST")
+	customersSubrouter.HandleFunc("/orders", s.handleCustomerGetOrders).Methods("GET")
+	customersSubrouter.HandleFunc("/loyalty", s.handleCustomerGetLoyalty).Methods("GET")
+	customersSubrouter.HandleFunc("/orders/{id:[0-9]+}", s.handleCustomerGetOrderByID).Methods("GET")
 
 	managersAuthenticateMd := middleware.Authenticate(s.managerSvc.IDByToken)
 	managersSubRouter := s.mux.PathPrefix("/api/managers").Subrouter()
 	managersSubRouter.Use(managersAuthenticateMd)
+	managersSubRouter.Use(middleware.Idempotent(s.managerSvc, middleware.IdempotencyWindow))
 	managersSubRouter.HandleFunc("", s.handleManagerRegistration).Methods("POST")
 	managersSubRouter.HandleFunc("/token", s.handleManagerGetToken).Methods("POST")
+	managersSubRouter.HandleFunc("/{id:[0-9]+}/boss", s.handleManagerSetBoss).Methods("POST")
+	managersSubRouter.HandleFunc("/{id:[0-9]+}/department", s.handleManagerAssignDepartment).Methods("POST")
+	managersSubRouter.HandleFunc("/{id:[0-9]+}/subordinates", s.handleManagerGetSubordinates).Methods("GET")
+	managersSubRouter.HandleFunc("/{id:[0-9]+}/team/sales", s.handleManagerGetTeamSales).Methods("GET")
+	managersSubRouter.HandleFunc("/org", s.handleManagerGetOrgChart).Methods("GET")
+	managersSubRouter.HandleFunc("/departments", s.handleManagerGetDepartments).Methods("GET")
+	managersSubRouter.HandleFunc("/departments", s.handleManagerSaveDepartment).Methods("POST")
+	managersSubRouter.HandleFunc("/departments/report", s.handleManagerGetDepartmentsReport).Methods("GET")
+	managersSubRouter.HandleFunc("/departments/{id:[0-9]+}", s.handleManagerGetDepartmentByID).Methods("GET")
+	managersSubRouter.HandleFunc("/departments/{id:[0-9]+}/plans", s.handleManagerGetDepartmentPlans).Methods("GET")
+	managersSubRouter.HandleFunc("/departments/{id:[0-9]+}/plans", s.handleManagerSaveDepartmentPlan).Methods("POST")
+	managersSubRouter.HandleFunc("/queue", s.handleManagerGetQueue).Methods("GET")
+	managersSubRouter.HandleFunc("/sales/list", s.handleManagerListSales).Methods("GET")
+	managersSubRouter.HandleFunc("/sales/{id:[0-9]+}", s.handleManagerGetSaleByID).Methods("GET")
+	managersSubRouter.HandleFunc("/sales/{id:[0-9]+}", s.handleManagerUpdateSale).Methods("POST")
+	managersSubRouter.HandleFunc("/sales/{id:[0-9]+}/receipt", s.handleManagerGetReceipt).Methods("GET")
+	managersSubRouter.HandleFunc("/sales/{id:[0-9]+}/payments", s.handleManagerAddPayments).Methods("POST")
+	managersSubRouter.HandleFunc("/sales/{id:[0-9]+}/status", s.handleManagerChangeSaleStatus).Methods("POST")
+	managersSubRouter.HandleFunc("/sales/{id:[0-9]+}/returns", s.handleManagerGetReturns).Methods("GET")
+	managersSubRouter.HandleFunc("/sales/{id:[0-9]+}/returns", s.handleManagerMakeReturn).Methods("POST")
+	managersSubRouter.HandleFunc("/commissions", s.handleManagerGetCommissionSchemes).Methods("GET")
+	managersSubRouter.HandleFunc("/commissions", s.handleManagerSaveCommissionScheme).Methods("POST")
+	managersSubRouter.HandleFunc("/commissions/assign", s.handleManagerAssignCommission).Methods("POST")
+	managersSubRouter.HandleFunc("/payroll", s.handleManagerGetPayrollRuns).Methods("GET")
+	managersSubRouter.HandleFunc("/payroll", s.handleManagerRunPayroll).Methods("POST")
+	managersSubRouter.HandleFunc("/payroll/{id:[0-9]+}", s.handleManagerGetPayrollRun).Methods("GET")
+	managersSubRouter.HandleFunc("/payroll/{id:[0-9]+}/lock", s.handleManagerLockPayroll).Methods("POST")
+	managersSubRouter.HandleFunc("/loyalty/rates", s.handleManagerGetLoyaltyRates).Methods("GET")
+	managersSubRouter.HandleFunc("/loyalty/rates", s.handleManagerSetLoyaltyRate).Methods("POST")
+	managersSubRouter.HandleFunc("/plans", s.handleManagerGetPlans).Methods("GET")
+	managersSubRouter.HandleFunc("/plans", s.handleManagerSavePlan).Methods("POST")
+	managersSubRouter.HandleFunc("/plans/progress", s.handleManagerGetPlansProgress).Methods("GET")
+	managersSubRouter.HandleFunc("/reports/sales", s.handleManagerGetSalesReport).Methods("GET")
 	managersSubRouter.HandleFunc("/sales", s.handleManagerGetSales).Methods("GET")
 	managersSubRouter.HandleFunc("/sales", s.handleManagerMakeSales).Methods("POST")
 	managersSubRouter.HandleFunc("/products", s.handleManagerGetProducts).Methods("GET")
 	managersSubRouter.HandleFunc("/products", s.handleManagerChangeProducts).Methods("POST")
+	managersSubRouter.HandleFunc("/products/{id:[0-9]+}", s.handleManagerGetProductByID).Methods("GET")
 	managersSubRouter.HandleFunc("/products/{id:[0-9]+}", s.handleManagerRemoveProductByID).Methods("DELETE")
+	managersSubRouter.HandleFunc("/products/{id:[0-9]+}/images", s.handleManagerUploadImages).Methods("POST")
+	managersSubRouter.HandleFunc("/products/{id:[0-9]+}/images/{imageID:[0-9]+}", s.handleManagerRemoveImage).Methods("DELETE")
+	managersSubRouter.HandleFunc("/promotions", s.handleManagerGetPromotions).Methods("GET")
+	managersSubRouter.HandleFunc("/promotions", s.handleManagerSavePromotion).Methods("POST")
+	managersSubRouter.HandleFunc("/coupons", s.handleManagerGetCoupons).Methods("GET")
+	managersSubRouter.HandleFunc("/coupons", s.handleManagerCreateCoupons).Methods("POST")
+	managersSubRouter.HandleFunc("/coupons/report", s.handleManagerGetCouponsReport).Methods("GET")
+	managersSubRouter.HandleFunc("/taxes", s.handleManagerGetTaxRates).Methods("GET")
+	managersSubRouter.HandleFunc("/taxes", s.handleManagerSaveTaxRate).Methods("POST")
+	managersSubRouter.HandleFunc("/taxes/categories", s.handleManagerSetCategoryTax).Methods("POST")
+	managersSubRouter.HandleFunc("/taxes/report", s.handleManagerGetTaxesReport).Methods("GET")
+	managersSubRouter.HandleFunc("/rates", s.handleManagerGetExchangeRates).Methods("GET")
+	managersSubRouter.HandleFunc("/rates", s.handleManagerSaveExchangeRates).Methods("POST")
+	managersSubRouter.HandleFunc("/attributes", s.handleManagerGetAttributes).Methods("GET")
+	managersSubRouter.HandleFunc("/attributes", s.handleManagerSaveAttribute).Methods("POST")
 	managersSubRouter.HandleFunc("/customers", s.handleManagerGetCustomers).Methods("GET")
 	managersSubRouter.HandleFunc("/customers", s.handleManagerChangeCustomer).Methods("POST")
+	managersSubRouter.HandleFunc("/customers/{id:[0-9]+}", s.handleManagerGetCustomerByID).Methods("GET")
 	managersSubRouter.HandleFunc("/customers/{id:[0-9]+}", s.handleManagerRemoveCustomerByID).Methods("DELETE")
 
 }
@@ -71,6 +144,19 @@ func errorWriter(w http.ResponseWriter, httpSts int, err error) {
 	http.Error(w, http.StatusText(httpSts), httpSts)
 }
 
+//это фукция для ответа с ошибкой, текст которой нужен клиенту: {"error": "..."}
+func errorMessageWriter(w http.ResponseWriter, httpSts int, err error) {
+	//печатаем ошибку
+	log.Print(err)
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpSts)
+	_, err = w.Write(data)
+	if err != nil {
+		log.Print(err)
+	}
+}
+
 //это функция для ответа в формате JSON (он принимает интерфейс по этому мы можем в нем передат все что захочется)
 func respondJSON(w http.ResponseWriter, iData interface{}) {
 
@@ -93,3 +179,26 @@ func respondJSON(w http.ResponseWriter, iData interface{}) {
 		log.Print(err)
 	}
 }
+
+//это функция для извлечения периода из параметров from и to (формат 2006-01-02, to включительно),
+//по умолчанию берем текущий месяц
+func periodParams(r *http.Request) (from, to time.Time, err error) {
+	now := time.Now()
+	from = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	to = from.AddDate(0, 1, 0)
+
+	if value := r.URL.Query().Get("from"); value != "" {
+		from, err = time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		to, err = time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	return
+}
@@ -6,6 +6,8 @@ create table if not exists customers
     phone 	text 	not null unique,
     password text 	not null,
     active 	boolean not null default true,
+    credit  integer not null default 0 check(credit >= 0),
+    version bigint not null default 1,
     created timestamp not null default current_timestamp 
 );
 
@@ -20,6 +22,7 @@ create table if not exists managers
     phone 	text 	not null unique,
     password text ,
     is_admin boolean not null default true,
+    price_override boolean not null default false,
     active 	boolean not null default true,
     created timestamp not null default current_timestamp 
 );
@@ -40,13 +43,34 @@ create table if not exists managers_tokens
     created timestamp not null default current_timestamp
 );
 
+create table if not exists tax_rates
+(
+    id      bigserial primary key,
+    name    text not null,
+    rate    integer not null check(rate >= 0 and rate < 10000),
+    active  boolean not null default true,
+    created timestamp not null default current_timestamp
+);
+
+create table if not exists categories_taxes
+(
+    category    text primary key,
+    tax_rate_id bigint not null references tax_rates
+);
+
 create table if not exists products 
 (
     id      bigserial primary key,
     name    text not null,
     price   integer not null check(price >0),
     qty     integer not null default 0 check(qty >=0),
+    category text not null default '',
+    description text not null default '',
+    attributes jsonb not null default '{}',
+    tax_rate_id bigint references tax_rates,
+    tax_exclusive boolean not null default false,
     active 	boolean not null default true,
+    version bigint not null default 1,
     created timestamp not null default current_timestamp 
 );
 
@@ -54,8 +78,15 @@ create table if not exists sales
 (
     id          bigserial primary key,
     manager_id  bigint not null references managers,
-    customer_id bigint not null,
-    created     timestamp not null default current_timestamp 
+    customer_id bigint constraint sales_customer_id_fkey references customers,
+    currency    text not null default 'TJS',
+    rate        numeric(18, 6) not null default 1,
+    coupon      text not null default '',
+    status      text not null default 'confirmed' check(status in ('draft', 'confirmed', 'paid', 'cancelled')),
+    created     timestamp not null default current_timestamp,
+    confirmed   timestamp,
+    paid        timestamp,
+    cancelled   timestamp
 );
 
 create table if not exists sales_positions 
@@ -65,5 +96,317 @@ create table if not exists sales_positions
     sale_id  bigint not null references sales,
     price integer not null check(price >= 0),
     qty     integer not null default 0 check(qty >=0),
+    discount integer not null default 0 check(discount >= 0),
+    tax_rate integer not null default 0,
+    tax_exclusive boolean not null default false,
+    net     integer not null default 0,
+    tax     integer not null default 0,
+    list_price integer not null default 0,
+    override_reason text not null default '',
+    override_by bigint references managers,
     created     timestamp not null default current_timestamp 
-);
\ No newline at end of file
+);
+
+create table if not exists promotions
+(
+    id          bigserial primary key,
+    name        text not null,
+    kind        text not null check(kind in ('percent', 'fixed', 'buy_x_get_y')),
+    value       integer not null default 0 check(value >= 0),
+    buy_qty     integer not null default 0 check(buy_qty >= 0),
+    free_qty    integer not null default 0 check(free_qty >= 0),
+    product_id  bigint references products,
+    category    text,
+    starts      timestamp,
+    ends        timestamp,
+    active      boolean not null default true,
+    created     timestamp not null default current_timestamp
+);
+
+create table if not exists sales_positions_discounts
+(
+    id           bigserial primary key,
+    position_id  bigint not null references sales_positions,
+    promotion_id bigint not null references promotions,
+    amount       integer not null check(amount >= 0),
+    created      timestamp not null default current_timestamp
+);
+
+create table if not exists coupons
+(
+    id           bigserial primary key,
+    code         text not null unique,
+    kind         text not null check(kind in ('percent', 'fixed')),
+    value        integer not null check(value > 0),
+    max_uses     integer not null default 0 check(max_uses >= 0),
+    per_customer integer not null default 0 check(per_customer >= 0),
+    used         integer not null default 0 check(used >= 0),
+    expires      timestamp,
+    active       boolean not null default true,
+    created      timestamp not null default current_timestamp
+);
+
+create table if not exists coupons_redemptions
+(
+    id          bigserial primary key,
+    coupon_id   bigint not null references coupons,
+    sale_id     bigint not null references sales,
+    customer_id bigint references customers,
+    amount      integer not null check(amount >= 0),
+    created     timestamp not null default current_timestamp
+);
+
+create table if not exists products_prices
+(
+    product_id bigint not null references products,
+    currency   text not null,
+    price      integer not null check(price > 0),
+    primary key (product_id, currency)
+);
+
+create table if not exists exchange_rates
+(
+    id       bigserial primary key,
+    currency text not null,
+    rate     numeric(18, 6) not null check(rate > 0),
+    created  timestamp not null default current_timestamp
+);
+
+create index if not exists exchange_rates_currency_idx on exchange_rates (currency, created desc);
+
+create table if not exists products_attributes
+(
+    category text not null,
+    name     text not null,
+    type     text not null check(type in ('string', 'number', 'boolean')),
+    required boolean not null default false,
+    primary key (category, name)
+);
+
+create table if not exists products_images
+(
+    id         bigserial primary key,
+    product_id bigint not null references products,
+    url        text not null,
+    thumbnail_url text not null default '',
+    blob_key   text not null default '',
+    thumbnail_key text not null default '',
+    position   integer not null default 0,
+    created    timestamp not null default current_timestamp,
+    unique (product_id, url)
+);
+
+create table if not exists returns
+(
+    id         bigserial primary key,
+    sale_id    bigint not null references sales,
+    manager_id bigint not null references managers,
+    reason     text not null default '',
+    refund     integer not null default 0 check(refund >= 0),
+    loyalty    integer not null default 0 check(loyalty >= 0),
+    store_credit boolean not null default false,
+    created    timestamp not null default current_timestamp
+);
+
+create table if not exists returns_positions
+(
+    id          bigserial primary key,
+    return_id   bigint not null references returns,
+    position_id bigint not null references sales_positions,
+    qty         integer not null check(qty > 0),
+    net         integer not null default 0,
+    tax         integer not null default 0,
+    created     timestamp not null default current_timestamp
+);
+
+create index if not exists returns_positions_position_idx on returns_positions (position_id);
+
+create table if not exists payments
+(
+    id         bigserial primary key,
+    sale_id    bigint not null references sales,
+    manager_id bigint not null references managers,
+    method     text not null check(method in ('cash', 'card', 'transfer', 'store_credit', 'loyalty')),
+    amount     integer not null check(amount > 0),
+    tendered   integer not null default 0 check(tendered >= 0),
+    change     integer not null default 0 check(change >= 0),
+    created    timestamp not null default current_timestamp
+);
+
+create index if not exists payments_sale_idx on payments (sale_id);
+
+create table if not exists documents_counters
+(
+    kind text primary key,
+    last bigint not null default 0
+);
+
+create table if not exists documents
+(
+    id      bigserial primary key,
+    sale_id bigint not null references sales,
+    kind    text not null check(kind in ('receipt', 'invoice')),
+    number  bigint not null,
+    created timestamp not null default current_timestamp,
+    unique (kind, number),
+    unique (sale_id, kind)
+);
+
+create table if not exists idempotency_keys
+(
+    owner_id     bigint not null,
+    key          text not null,
+    request_hash text not null,
+    status       integer not null default 0,
+    headers      jsonb not null default '{}',
+    body         bytea,
+    created      timestamp not null default current_timestamp,
+    primary key (owner_id, key)
+);
+
+create table if not exists managers_plans
+(
+    id         bigserial primary key,
+    manager_id bigint not null references managers,
+    period     date not null,
+    amount     integer not null check(amount >= 0),
+    created_by bigint references managers,
+    created    timestamp not null default current_timestamp
+);
+
+create index if not exists managers_plans_period_idx on managers_plans (manager_id, period);
+
+create table if not exists commission_schemes
+(
+    id         bigserial primary key,
+    name       text not null,
+    kind       text not null check(kind in ('flat', 'tiered', 'category')),
+    rate       integer not null default 0 check(rate >= 0 and rate <= 10000),
+    tiers      jsonb not null default '[]',
+    categories jsonb not null default '{}',
+    active     boolean not null default true,
+    created    timestamp not null default current_timestamp
+);
+
+alter table managers add column if not exists commission_scheme_id bigint references commission_schemes;
+
+create table if not exists payroll_runs
+(
+    id        bigserial primary key,
+    period    date not null unique,
+    status    text not null default 'draft' check(status in ('draft', 'locked')),
+    total     integer not null default 0,
+    created   timestamp not null default current_timestamp,
+    computed  timestamp not null default current_timestamp,
+    locked    timestamp,
+    locked_by bigint references managers
+);
+
+create table if not exists payroll_lines
+(
+    id         bigserial primary key,
+    run_id     bigint not null references payroll_runs,
+    manager_id bigint not null references managers,
+    scheme_id  bigint references commission_schemes,
+    plan       integer not null default 0,
+    revenue    integer not null default 0,
+    salary     integer not null default 0,
+    commission integer not null default 0,
+    total      integer not null default 0,
+    unique (run_id, manager_id)
+);
+
+alter table sales add column if not exists source text not null default 'manager' check(source in ('manager', 'cart'));
+
+create index if not exists sales_queue_idx on sales (manager_id) where status = 'draft' and source = 'cart';
+
+create table if not exists carts
+(
+    customer_id bigint primary key references customers,
+    currency    text not null default 'TJS',
+    created     timestamp not null default current_timestamp,
+    updated     timestamp not null default current_timestamp
+);
+
+create table if not exists carts_items
+(
+    customer_id bigint not null references carts,
+    product_id  bigint not null references products,
+    qty         integer not null check(qty > 0),
+    price       integer not null check(price > 0),
+    created     timestamp not null default current_timestamp,
+    updated     timestamp not null default current_timestamp,
+    primary key (customer_id, product_id)
+);
+
+create table if not exists stock_reservations
+(
+    id         bigserial primary key,
+    product_id bigint not null references products,
+    sale_id    bigint not null references sales,
+    qty        integer not null check(qty > 0),
+    expires    timestamp not null,
+    created    timestamp not null default current_timestamp
+);
+
+create index if not exists stock_reservations_product_idx on stock_reservations (product_id, expires);
+create index if not exists stock_reservations_sale_idx on stock_reservations (sale_id);
+
+create table if not exists loyalty_rates
+(
+    category text primary key,
+    rate     integer not null check(rate > 0 and rate <= 10000)
+);
+
+create table if not exists loyalty_ledger
+(
+    id          bigserial primary key,
+    customer_id bigint not null references customers,
+    sale_id     bigint references sales,
+    payment_id  bigint references payments,
+    kind        text not null check(kind in ('earn', 'redeem', 'expire', 'reverse')),
+    points      integer not null,
+    remaining   integer not null default 0 check(remaining >= 0),
+    expires     timestamp,
+    created     timestamp not null default current_timestamp
+);
+
+create index if not exists loyalty_ledger_customer_idx on loyalty_ledger (customer_id, id);
+create index if not exists loyalty_ledger_open_idx on loyalty_ledger (expires) where kind = 'earn' and remaining > 0;
+
+create table if not exists sales_orphan_customers
+(
+    sale_id     bigint primary key references sales,
+    customer_id bigint not null,
+    created     timestamp not null default current_timestamp
+);
+
+create index if not exists managers_boss_idx on managers (boss_id);
+
+create table if not exists departments
+(
+    id      bigserial primary key,
+    name    text not null,
+    head_id bigint references managers,
+    budget  integer not null default 0 check(budget >= 0),
+    active  boolean not null default true,
+    created timestamp not null default current_timestamp
+);
+
+create unique index if not exists departments_name_idx on departments (lower(name));
+
+create table if not exists departments_plans
+(
+    id            bigserial primary key,
+    department_id bigint not null references departments,
+    period        date not null,
+    amount        integer not null check(amount >= 0),
+    created_by    bigint references managers,
+    created       timestamp not null default current_timestamp
+);
+
+create index if not exists departments_plans_period_idx on departments_plans (department_id, period);
+
+alter table managers add column if not exists department_id bigint references departments;
+
+create index if not exists managers_department_idx on managers (department_id);
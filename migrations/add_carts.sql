@@ -0,0 +1,22 @@
+alter table sales add column if not exists source text not null default 'manager' check(source in ('manager', 'cart'));
+
+create index if not exists sales_queue_idx on sales (manager_id) where status = 'draft' and source = 'cart';
+
+create table if not exists carts
+(
+    customer_id bigint primary key references customers,
+    currency    text not null default 'TJS',
+    created     timestamp not null default current_timestamp,
+    updated     timestamp not null default current_timestamp
+);
+
+create table if not exists carts_items
+(
+    customer_id bigint not null references carts,
+    product_id  bigint not null references products,
+    qty         integer not null check(qty > 0),
+    price       integer not null check(price > 0),
+    created     timestamp not null default current_timestamp,
+    updated     timestamp not null default current_timestamp,
+    primary key (customer_id, product_id)
+);
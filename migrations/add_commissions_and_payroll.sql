@@ -0,0 +1,39 @@
+create table if not exists commission_schemes
+(
+    id         bigserial primary key,
+    name       text not null,
+    kind       text not null check(kind in ('flat', 'tiered', 'category')),
+    rate       integer not null default 0 check(rate >= 0 and rate <= 10000),
+    tiers      jsonb not null default '[]',
+    categories jsonb not null default '{}',
+    active     boolean not null default true,
+    created    timestamp not null default current_timestamp
+);
+
+alter table managers add column if not exists commission_scheme_id bigint references commission_schemes;
+
+create table if not exists payroll_runs
+(
+    id        bigserial primary key,
+    period    date not null unique,
+    status    text not null default 'draft' check(status in ('draft', 'locked')),
+    total     integer not null default 0,
+    created   timestamp not null default current_timestamp,
+    computed  timestamp not null default current_timestamp,
+    locked    timestamp,
+    locked_by bigint references managers
+);
+
+create table if not exists payroll_lines
+(
+    id         bigserial primary key,
+    run_id     bigint not null references payroll_runs,
+    manager_id bigint not null references managers,
+    scheme_id  bigint references commission_schemes,
+    plan       integer not null default 0,
+    revenue    integer not null default 0,
+    salary     integer not null default 0,
+    commission integer not null default 0,
+    total      integer not null default 0,
+    unique (run_id, manager_id)
+);
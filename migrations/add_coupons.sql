@@ -0,0 +1,23 @@
+create table if not exists coupons
+(
+    id           bigserial primary key,
+    code         text not null unique,
+    kind         text not null check(kind in ('percent', 'fixed')),
+    value        integer not null check(value > 0),
+    max_uses     integer not null default 0 check(max_uses >= 0),
+    per_customer integer not null default 0 check(per_customer >= 0),
+    used         integer not null default 0 check(used >= 0),
+    expires      timestamp,
+    active       boolean not null default true,
+    created      timestamp not null default current_timestamp
+);
+
+create table if not exists coupons_redemptions
+(
+    id          bigserial primary key,
+    coupon_id   bigint not null references coupons,
+    sale_id     bigint not null references sales,
+    customer_id bigint not null,
+    amount      integer not null check(amount >= 0),
+    created     timestamp not null default current_timestamp
+);
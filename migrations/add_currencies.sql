@@ -0,0 +1,20 @@
+create table if not exists products_prices
+(
+    product_id bigint not null references products,
+    currency   text not null,
+    price      integer not null check(price > 0),
+    primary key (product_id, currency)
+);
+
+create table if not exists exchange_rates
+(
+    id       bigserial primary key,
+    currency text not null,
+    rate     numeric(18, 6) not null check(rate > 0),
+    created  timestamp not null default current_timestamp
+);
+
+create index if not exists exchange_rates_currency_idx on exchange_rates (currency, created desc);
+
+alter table sales add column if not exists currency text not null default 'TJS';
+alter table sales add column if not exists rate numeric(18, 6) not null default 1;
@@ -0,0 +1,41 @@
+create table if not exists departments
+(
+    id      bigserial primary key,
+    name    text not null,
+    head_id bigint references managers,
+    budget  integer not null default 0 check(budget >= 0),
+    active  boolean not null default true,
+    created timestamp not null default current_timestamp
+);
+
+create unique index if not exists departments_name_idx on departments (lower(name));
+
+create table if not exists departments_plans
+(
+    id            bigserial primary key,
+    department_id bigint not null references departments,
+    period        date not null,
+    amount        integer not null check(amount >= 0),
+    created_by    bigint references managers,
+    created       timestamp not null default current_timestamp
+);
+
+create index if not exists departments_plans_period_idx on departments_plans (department_id, period);
+
+alter table managers add column if not exists department_id bigint references departments;
+
+create index if not exists managers_department_idx on managers (department_id);
+
+-- свободный текст departament превращаем в отделы (без учета регистра и пробелов по краям)
+insert into departments (name)
+select distinct on (lower(trim(departament))) trim(departament)
+from managers
+where trim(coalesce(departament, '')) <> ''
+order by lower(trim(departament)), trim(departament)
+on conflict (lower(name)) do nothing;
+
+update managers m set department_id = d.id
+from departments d
+where m.department_id is null and lower(d.name) = lower(trim(m.departament));
+
+-- колонку departament не удаляем (на случай отката), приложение её больше не использует
@@ -0,0 +1,16 @@
+create table if not exists documents_counters
+(
+    kind text primary key,
+    last bigint not null default 0
+);
+
+create table if not exists documents
+(
+    id      bigserial primary key,
+    sale_id bigint not null references sales,
+    kind    text not null check(kind in ('receipt', 'invoice')),
+    number  bigint not null,
+    created timestamp not null default current_timestamp,
+    unique (kind, number),
+    unique (sale_id, kind)
+);
@@ -0,0 +1,11 @@
+create table if not exists idempotency_keys
+(
+    owner_id     bigint not null,
+    key          text not null,
+    request_hash text not null,
+    status       integer not null default 0,
+    headers      jsonb not null default '{}',
+    body         bytea,
+    created      timestamp not null default current_timestamp,
+    primary key (owner_id, key)
+);
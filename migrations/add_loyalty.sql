@@ -0,0 +1,26 @@
+alter table payments drop constraint if exists payments_method_check;
+alter table payments add constraint payments_method_check check(method in ('cash', 'card', 'transfer', 'store_credit', 'loyalty'));
+
+create table if not exists loyalty_rates
+(
+    category text primary key,
+    rate     integer not null check(rate > 0 and rate <= 10000)
+);
+
+create table if not exists loyalty_ledger
+(
+    id          bigserial primary key,
+    customer_id bigint not null references customers,
+    sale_id     bigint references sales,
+    payment_id  bigint references payments,
+    kind        text not null check(kind in ('earn', 'redeem', 'expire', 'reverse')),
+    points      integer not null,
+    remaining   integer not null default 0 check(remaining >= 0),
+    expires     timestamp,
+    created     timestamp not null default current_timestamp
+);
+
+create index if not exists loyalty_ledger_customer_idx on loyalty_ledger (customer_id, id);
+create index if not exists loyalty_ledger_open_idx on loyalty_ledger (expires) where kind = 'earn' and remaining > 0;
+
+alter table returns add column if not exists loyalty integer not null default 0 check(loyalty >= 0);
@@ -0,0 +1 @@
+create index if not exists managers_boss_idx on managers (boss_id);
@@ -0,0 +1,16 @@
+create table if not exists managers_plans
+(
+    id         bigserial primary key,
+    manager_id bigint not null references managers,
+    period     date not null,
+    amount     integer not null check(amount >= 0),
+    created_by bigint references managers,
+    created    timestamp not null default current_timestamp
+);
+
+create index if not exists managers_plans_period_idx on managers_plans (manager_id, period);
+
+-- старый plan из managers считаем планом на текущий месяц
+insert into managers_plans (manager_id, period, amount)
+select id, date_trunc('month', current_date), plan from managers where plan > 0
+and not exists (select 1 from managers_plans mp where mp.manager_id = managers.id);
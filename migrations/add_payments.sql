@@ -0,0 +1,16 @@
+alter table customers add column if not exists credit integer not null default 0 check(credit >= 0);
+alter table returns add column if not exists store_credit boolean not null default false;
+
+create table if not exists payments
+(
+    id         bigserial primary key,
+    sale_id    bigint not null references sales,
+    manager_id bigint not null references managers,
+    method     text not null check(method in ('cash', 'card', 'transfer', 'store_credit')),
+    amount     integer not null check(amount > 0),
+    tendered   integer not null default 0 check(tendered >= 0),
+    change     integer not null default 0 check(change >= 0),
+    created    timestamp not null default current_timestamp
+);
+
+create index if not exists payments_sale_idx on payments (sale_id);
@@ -0,0 +1,8 @@
+alter table managers add column if not exists price_override boolean not null default false;
+
+alter table sales_positions add column if not exists list_price integer not null default 0;
+alter table sales_positions add column if not exists override_reason text not null default '';
+alter table sales_positions add column if not exists override_by bigint references managers;
+
+-- до этого цена позиции и была ценой из запроса, считаем её каталожной
+update sales_positions set list_price = price where list_price = 0;
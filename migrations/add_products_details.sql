@@ -0,0 +1,21 @@
+alter table products add column if not exists description text not null default '';
+alter table products add column if not exists attributes jsonb not null default '{}';
+
+create table if not exists products_attributes
+(
+    category text not null,
+    name     text not null,
+    type     text not null check(type in ('string', 'number', 'boolean')),
+    required boolean not null default false,
+    primary key (category, name)
+);
+
+create table if not exists products_images
+(
+    id         bigserial primary key,
+    product_id bigint not null references products,
+    url        text not null,
+    position   integer not null default 0,
+    created    timestamp not null default current_timestamp,
+    unique (product_id, url)
+);
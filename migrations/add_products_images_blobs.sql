@@ -0,0 +1,3 @@
+alter table products_images add column if not exists thumbnail_url text not null default '';
+alter table products_images add column if not exists blob_key text not null default '';
+alter table products_images add column if not exists thumbnail_key text not null default '';
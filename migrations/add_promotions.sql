@@ -0,0 +1,27 @@
+alter table products add column if not exists category text not null default '';
+alter table sales_positions add column if not exists discount integer not null default 0 check(discount >= 0);
+
+create table if not exists promotions
+(
+    id          bigserial primary key,
+    name        text not null,
+    kind        text not null check(kind in ('percent', 'fixed', 'buy_x_get_y')),
+    value       integer not null default 0 check(value >= 0),
+    buy_qty     integer not null default 0 check(buy_qty >= 0),
+    free_qty    integer not null default 0 check(free_qty >= 0),
+    product_id  bigint references products,
+    category    text,
+    starts      timestamp,
+    ends        timestamp,
+    active      boolean not null default true,
+    created     timestamp not null default current_timestamp
+);
+
+create table if not exists sales_positions_discounts
+(
+    id           bigserial primary key,
+    position_id  bigint not null references sales_positions,
+    promotion_id bigint not null references promotions,
+    amount       integer not null check(amount >= 0),
+    created      timestamp not null default current_timestamp
+);
@@ -0,0 +1,22 @@
+create table if not exists returns
+(
+    id         bigserial primary key,
+    sale_id    bigint not null references sales,
+    manager_id bigint not null references managers,
+    reason     text not null default '',
+    refund     integer not null default 0 check(refund >= 0),
+    created    timestamp not null default current_timestamp
+);
+
+create table if not exists returns_positions
+(
+    id          bigserial primary key,
+    return_id   bigint not null references returns,
+    position_id bigint not null references sales_positions,
+    qty         integer not null check(qty > 0),
+    net         integer not null default 0,
+    tax         integer not null default 0,
+    created     timestamp not null default current_timestamp
+);
+
+create index if not exists returns_positions_position_idx on returns_positions (position_id);
@@ -0,0 +1,33 @@
+-- анонимная продажа (покупатель без карточки) хранится с customer_id = null
+alter table sales alter column customer_id drop not null;
+
+-- ссылки на несуществующих покупателей сохраняем отдельно и делаем такие продажи анонимными
+create table if not exists sales_orphan_customers
+(
+    sale_id     bigint primary key references sales,
+    customer_id bigint not null,
+    created     timestamp not null default current_timestamp
+);
+
+insert into sales_orphan_customers (sale_id, customer_id)
+select s.id, s.customer_id from sales s
+where s.customer_id is not null and not exists (select 1 from customers c where c.id = s.customer_id)
+on conflict (sale_id) do nothing;
+
+update sales s set customer_id = null
+where s.customer_id is not null and not exists (select 1 from customers c where c.id = s.customer_id);
+
+-- not valid + validate не блокирует запись в sales на время проверки существующих строк
+alter table sales drop constraint if exists sales_customer_id_fkey;
+alter table sales add constraint sales_customer_id_fkey foreign key (customer_id) references customers not valid;
+alter table sales validate constraint sales_customer_id_fkey;
+
+-- погашения купонов анонимными продажами хранились с customer_id = 0, теперь это null
+alter table coupons_redemptions alter column customer_id drop not null;
+
+update coupons_redemptions r set customer_id = null
+where r.customer_id is not null and not exists (select 1 from customers c where c.id = r.customer_id);
+
+alter table coupons_redemptions drop constraint if exists coupons_redemptions_customer_id_fkey;
+alter table coupons_redemptions add constraint coupons_redemptions_customer_id_fkey foreign key (customer_id) references customers not valid;
+alter table coupons_redemptions validate constraint coupons_redemptions_customer_id_fkey;
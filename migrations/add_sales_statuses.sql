@@ -0,0 +1,14 @@
+alter table sales add column if not exists coupon text not null default '';
+alter table sales add column if not exists status text not null default 'confirmed'
+    check(status in ('draft', 'confirmed', 'paid', 'cancelled'));
+alter table sales add column if not exists confirmed timestamp;
+alter table sales add column if not exists paid timestamp;
+alter table sales add column if not exists cancelled timestamp;
+
+-- до этого все продажи проводились сразу при создании
+update sales set confirmed = created where confirmed is null and status = 'confirmed';
+
+update sales s set coupon = c.code
+from coupons_redemptions r
+join coupons c on c.id = r.coupon_id
+where r.sale_id = s.id and s.coupon = '';
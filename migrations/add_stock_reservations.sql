@@ -0,0 +1,12 @@
+create table if not exists stock_reservations
+(
+    id         bigserial primary key,
+    product_id bigint not null references products,
+    sale_id    bigint not null references sales,
+    qty        integer not null check(qty > 0),
+    expires    timestamp not null,
+    created    timestamp not null default current_timestamp
+);
+
+create index if not exists stock_reservations_product_idx on stock_reservations (product_id, expires);
+create index if not exists stock_reservations_sale_idx on stock_reservations (sale_id);
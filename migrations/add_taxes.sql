@@ -0,0 +1,25 @@
+create table if not exists tax_rates
+(
+    id      bigserial primary key,
+    name    text not null,
+    rate    integer not null check(rate >= 0 and rate < 10000),
+    active  boolean not null default true,
+    created timestamp not null default current_timestamp
+);
+
+create table if not exists categories_taxes
+(
+    category    text primary key,
+    tax_rate_id bigint not null references tax_rates
+);
+
+alter table products add column if not exists tax_rate_id bigint references tax_rates;
+alter table products add column if not exists tax_exclusive boolean not null default false;
+
+alter table sales_positions add column if not exists tax_rate integer not null default 0;
+alter table sales_positions add column if not exists tax_exclusive boolean not null default false;
+alter table sales_positions add column if not exists net integer not null default 0;
+alter table sales_positions add column if not exists tax integer not null default 0;
+
+-- старые продажи были без налога: вся сумма позиции это база
+update sales_positions set net = qty * price - discount where net = 0;
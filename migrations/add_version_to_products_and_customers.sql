@@ -0,0 +1,2 @@
+alter table products add column if not exists version bigint not null default 1;
+alter table customers add column if not exists version bigint not null default 1;
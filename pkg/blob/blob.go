@@ -0,0 +1,75 @@
+package blob
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+//Store ... хранилище файлов (картинок товаров); key это относительный путь вида products/1/abc.jpg
+type Store interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+//LocalStore ... хранит файлы в папке на диске и сам же их раздает (реализует http.Handler)
+type LocalStore struct {
+	dir     string
+	baseURL string
+	files   http.Handler
+}
+
+//NewLocalStore ... baseURL это префикс по которому сервер раздает файлы, например /media
+func NewLocalStore(dir, baseURL string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{
+		dir:     dir,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		files:   http.FileServer(http.Dir(dir)),
+	}, nil
+}
+
+//Put ...
+func (s *LocalStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+	name := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, data, 0644)
+}
+
+//Delete ...
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+//URL ...
+func (s *LocalStore) URL(key string) string {
+	return s.baseURL + "/" + key
+}
+
+//BaseURL ...
+func (s *LocalStore) BaseURL() string {
+	return s.baseURL
+}
+
+//ServeHTTP ... раздаем файлы, путь запроса должен быть уже без baseURL
+func (s *LocalStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.files.ServeHTTP(w, r)
+}
+
+//path ... Clean от корня не дает ключу выйти за пределы папки через ../
+func (s *LocalStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(path.Clean("/"+key)))
+}
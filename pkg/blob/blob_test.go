@@ -0,0 +1,72 @@
+package blob
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewLocalStore(filepath.Join(dir, "media"), "/media/")
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+	ctx := context.Background()
+	key := "products/1/abc.jpg"
+	data := []byte("image data")
+
+	if err = store.Put(ctx, key, "image/jpeg", data); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if url := store.URL(key); url != "/media/products/1/abc.jpg" {
+		t.Errorf("URL = %s", url)
+	}
+
+	w := httptest.NewRecorder()
+	store.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products/1/abc.jpg", nil))
+	if w.Code != http.StatusOK || w.Body.String() != string(data) {
+		t.Errorf("GET = %d %q, want 200 %q", w.Code, w.Body.String(), data)
+	}
+
+	if err = store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "media", "products", "1", "abc.jpg")); !os.IsNotExist(err) {
+		t.Errorf("file still exists after Delete: %v", err)
+	}
+	if err = store.Delete(ctx, key); err != nil {
+		t.Errorf("Delete missing: %v", err)
+	}
+}
+
+func TestLocalStoreKeyStaysInDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewLocalStore(filepath.Join(dir, "media"), "/media")
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+	if err = store.Put(context.Background(), "../../escape.txt", "text/plain", []byte("x")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "media", "escape.txt")); err != nil {
+		t.Errorf("file not written inside store dir: %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "escape.txt")); !os.IsNotExist(err) {
+		t.Errorf("file escaped store dir: %v", err)
+	}
+}
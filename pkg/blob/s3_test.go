@@ -0,0 +1,217 @@
+package blob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testRegion    = "us-east-1"
+	testBucket    = "media"
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+//fakeS3 ... минимальный S3: проверяет подпись PUT и DELETE, хранит объекты в памяти, GET отдает без подписи
+type fakeS3 struct {
+	t       *testing.T
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+	paths   []string
+	fail    int
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	fake := &fakeS3{t: t, objects: make(map[string][]byte), types: make(map[string]string)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.paths = append(f.paths, r.Method+" "+r.URL.EscapedPath())
+
+	if f.fail != 0 {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", f.fail)
+		return
+	}
+
+	path := r.URL.Path
+	if r.Method == http.MethodGet {
+		data, ok := f.objects[path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", f.types[path])
+		w.Write(data)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		f.t.Errorf("read body: %v", err)
+	}
+	if msg := verifySignature(r, body); msg != "" {
+		f.t.Errorf("%s %s: %s", r.Method, r.URL.EscapedPath(), msg)
+		http.Error(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[path] = body
+		f.types[path] = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		if _, ok := f.objects[path]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		delete(f.objects, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+//verifySignature ... независимо от S3Store.sign пересчитывает подпись SigV4 по пришедшему запросу
+func verifySignature(r *http.Request, body []byte) string {
+	payloadHash := sha256Hex(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != payloadHash {
+		return "payload hash mismatch"
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	when, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil {
+		return "bad X-Amz-Date " + amzDate
+	}
+	if d := time.Since(when); d > time.Minute || d < -time.Minute {
+		return "stale X-Amz-Date " + amzDate
+	}
+
+	scope := when.Format("20060102") + "/" + testRegion + "/s3/aws4_request"
+	auth := r.Header.Get("Authorization")
+	prefix := "AWS4-HMAC-SHA256 Credential=" + testAccessKey + "/" + scope + ", SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="
+	if !strings.HasPrefix(auth, prefix) {
+		return "unexpected Authorization " + auth
+	}
+
+	canonical := r.Method + "\n" + r.URL.EscapedPath() + "\n" + r.URL.RawQuery + "\n" +
+		"host:" + r.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n\n" +
+		"host;x-amz-content-sha256;x-amz-date\n" + payloadHash
+	sum := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := []byte("AWS4" + testSecretKey)
+	for _, part := range []string{when.Format("20060102"), testRegion, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	if want := hex.EncodeToString(hmacSHA256(key, stringToSign)); auth[len(prefix):] != want {
+		return "signature mismatch"
+	}
+	return ""
+}
+
+func newTestS3Store(t *testing.T, endpoint string) *S3Store {
+	store, err := NewS3Store(endpoint+"/", testRegion, testBucket, testAccessKey, testSecretKey, "")
+	if err != nil {
+		t.Fatalf("NewS3Store: %v", err)
+	}
+	return store
+}
+
+func TestS3StorePutGetDelete(t *testing.T) {
+	fake, server := newFakeS3(t)
+	store := newTestS3Store(t, server.URL)
+	ctx := context.Background()
+	key := "products/1/abc def+1.jpg"
+	data := []byte("image data")
+
+	if err := store.Put(ctx, key, "image/jpeg", data); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	url := store.URL(key)
+	if want := server.URL + "/media/products/1/abc%20def%2B1.jpg"; url != want {
+		t.Errorf("URL = %s, want %s", url, want)
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	got, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(got) != string(data) {
+		t.Errorf("GET = %d %q, want 200 %q", resp.StatusCode, got, data)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "image/jpeg" {
+		t.Errorf("Content-Type = %s, want image/jpeg", ct)
+	}
+
+	if err = store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if len(fake.objects) != 0 {
+		t.Errorf("objects left after Delete: %d", len(fake.objects))
+	}
+	//повторное удаление: S3 отвечает 404, для хранилища это не ошибка
+	if err = store.Delete(ctx, key); err != nil {
+		t.Errorf("Delete missing: %v", err)
+	}
+
+	want := []string{
+		"PUT /media/products/1/abc%20def%2B1.jpg",
+		"GET /media/products/1/abc%20def%2B1.jpg",
+		"DELETE /media/products/1/abc%20def%2B1.jpg",
+		"DELETE /media/products/1/abc%20def%2B1.jpg",
+	}
+	if strings.Join(fake.paths, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests:\n%s\nwant:\n%s", strings.Join(fake.paths, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestS3StoreErrors(t *testing.T) {
+	fake, server := newFakeS3(t)
+	store := newTestS3Store(t, server.URL)
+	ctx := context.Background()
+
+	fake.fail = http.StatusForbidden
+	err := store.Put(ctx, "products/1/a.jpg", "image/jpeg", []byte("x"))
+	status, ok := err.(*StatusError)
+	if !ok {
+		t.Fatalf("Put err = %v, want *StatusError", err)
+	}
+	if status.Code != http.StatusForbidden || status.Method != http.MethodPut || status.Path != "/media/products/1/a.jpg" {
+		t.Errorf("StatusError = %+v", status)
+	}
+	if !strings.Contains(status.Body, "AccessDenied") {
+		t.Errorf("Body = %q, want S3 error code", status.Body)
+	}
+	if err = store.Delete(ctx, "products/1/a.jpg"); err == nil {
+		t.Error("Delete: expected error on 403")
+	}
+}
+
+func TestS3StorePublicURL(t *testing.T) {
+	store, err := NewS3Store("http://localhost:9000", testRegion, testBucket, testAccessKey, testSecretKey, "https://cdn.example.com/")
+	if err != nil {
+		t.Fatalf("NewS3Store: %v", err)
+	}
+	if url := store.URL("products/2/a b.png"); url != "https://cdn.example.com/products/2/a%20b.png" {
+		t.Errorf("URL = %s", url)
+	}
+}
@@ -0,0 +1,226 @@
+package customers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/money"
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/jackc/pgx/v4"
+)
+
+//Cart ... корзина клиента в валюте Currency; Valid - все товары в наличии и цены не менялись
+//с момента добавления, только такую корзину можно оформить
+type Cart struct {
+	Currency string      `json:"currency"`
+	Items    []*CartItem `json:"items"`
+	Total    int         `json:"total"`
+	Valid    bool        `json:"valid"`
+}
+
+//CartItem ... Price - текущая цена, AddedPrice - цена когда товар положили в корзину,
+//Available - сколько доступно (на складе за вычетом резервов)
+type CartItem struct {
+	ProductID    int64       `json:"product_id"`
+	Name         string      `json:"name"`
+	Qty          int         `json:"qty"`
+	Price        money.Money `json:"price"`
+	AddedPrice   money.Money `json:"added_price"`
+	PriceChanged bool        `json:"price_changed"`
+	Available    int         `json:"available"`
+	InStock      bool        `json:"in_stock"`
+	Updated      time.Time   `json:"updated"`
+}
+
+//Cart ... корзина с проверкой цен и остатков на текущий момент
+func (s *Service) Cart(ctx context.Context, customerID int64) (*Cart, error) {
+	cart := &Cart{Currency: money.Base, Items: make([]*CartItem, 0), Valid: true}
+
+	err := s.db.QueryRow(ctx, `select currency from carts where customer_id = $1`, customerID).Scan(&cart.Currency)
+	if err != nil && err != pgx.ErrNoRows {
+		log.Print(err)
+		return nil, ErrInternal
+	}
+	currency, rate, err := s.rate(ctx, cart.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlStatement := `
+	select ci.product_id, p.name, ci.qty, ci.price, p.price, pp.price, ` + availableQty + `, p.active, ci.updated
+	from carts_items ci
+	join products p on p.id = ci.product_id
+	left join products_prices pp on pp.product_id = p.id and pp.currency = $2
+	where ci.customer_id = $1
+	order by ci.created`
+	rows, err := s.db.Query(ctx, sqlStatement, customerID, currency)
+	if err != nil {
+		log.Print(err)
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &CartItem{AddedPrice: money.Money{Currency: currency}}
+		var base int
+		var price *int
+		active := false
+		err = rows.Scan(&item.ProductID, &item.Name, &item.Qty, &item.AddedPrice.Amount, &base, &price, &item.Available, &active, &item.Updated)
+		if err != nil {
+			log.Print(err)
+			return nil, ErrInternal
+		}
+
+		var priced bool
+		item.Price, priced = priceIn(base, price, currency, rate)
+		item.PriceChanged = !priced || item.Price.Amount != item.AddedPrice.Amount
+		item.InStock = active && item.Qty <= item.Available
+		if !active {
+			item.Available = 0
+		}
+		cart.Valid = cart.Valid && priced && !item.PriceChanged && item.InStock
+		cart.Total += item.Price.Amount * item.Qty
+		cart.Items = append(cart.Items, item)
+	}
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, ErrInternal
+	}
+	cart.Valid = cart.Valid && len(cart.Items) > 0
+
+	return cart, nil
+}
+
+//SetCartCurrency ... меняет валюту корзины, цены в ней запоминаются заново
+func (s *Service) SetCartCurrency(ctx context.Context, customerID int64, currency string) (*Cart, error) {
+	currency, _, err := s.rate(ctx, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlStatement := `
+	insert into carts (customer_id, currency) values ($1, $2)
+	on conflict (customer_id) do update set currency = excluded.currency, updated = current_timestamp`
+	if _, err = s.db.Exec(ctx, sqlStatement, customerID, currency); err != nil {
+		log.Print(err)
+		return nil, ErrInternal
+	}
+	return s.AcceptCartPrices(ctx, customerID)
+}
+
+//AddCartItem ... кладет qty штук товара в корзину (к тому что уже лежит)
+func (s *Service) AddCartItem(ctx context.Context, customerID, productID int64, qty int) (*Cart, error) {
+	return s.saveCartItem(ctx, customerID, productID, qty, true)
+}
+
+//UpdateCartItem ... задает количество товара в корзине, 0 убирает товар
+func (s *Service) UpdateCartItem(ctx context.Context, customerID, productID int64, qty int) (*Cart, error) {
+	if qty == 0 {
+		return s.RemoveCartItem(ctx, customerID, productID)
+	}
+	return s.saveCartItem(ctx, customerID, productID, qty, false)
+}
+
+//RemoveCartItem ...
+func (s *Service) RemoveCartItem(ctx context.Context, customerID, productID int64) (*Cart, error) {
+	_, err := s.db.Exec(ctx, `delete from carts_items where customer_id = $1 and product_id = $2`, customerID, productID)
+	if err != nil {
+		log.Print(err)
+		return nil, ErrInternal
+	}
+	return s.Cart(ctx, customerID)
+}
+
+//AcceptCartPrices ... запоминает текущие цены товаров корзины (клиент увидел новые цены)
+func (s *Service) AcceptCartPrices(ctx context.Context, customerID int64) (*Cart, error) {
+	cart, err := s.Cart(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range cart.Items {
+		if !item.PriceChanged {
+			continue
+		}
+		_, err = s.db.Exec(ctx, `update carts_items set price = $3, updated = current_timestamp where customer_id = $1 and product_id = $2`,
+			customerID, item.ProductID, item.Price.Amount)
+		if err != nil {
+			log.Print(err)
+			return nil, ErrInternal
+		}
+	}
+	return s.Cart(ctx, customerID)
+}
+
+//saveCartItem ... проверяет товар, остаток и цену в валюте корзины и сохраняет позицию
+func (s *Service) saveCartItem(ctx context.Context, customerID, productID int64, qty int, add bool) (*Cart, error) {
+	if qty <= 0 {
+		return nil, types.ErrInvalidPosition
+	}
+
+	currency := money.Base
+	err := s.db.QueryRow(ctx, `select currency from carts where customer_id = $1`, customerID).Scan(&currency)
+	if err != nil && err != pgx.ErrNoRows {
+		log.Print(err)
+		return nil, ErrInternal
+	}
+	currency, rate, err := s.rate(ctx, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	var base, stock int
+	var price *int
+	sqlStatement := `
+	select p.price, pp.price, ` + availableQty + `
+	from products p
+	left join products_prices pp on pp.product_id = p.id and pp.currency = $2
+	where p.id = $1 and p.active`
+	err = s.db.QueryRow(ctx, sqlStatement, productID, currency).Scan(&base, &price, &stock)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrInvalidPosition
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, ErrInternal
+	}
+	current, ok := priceIn(base, price, currency, rate)
+	if !ok {
+		return nil, types.ErrNoExchangeRate
+	}
+
+	_, err = s.db.Exec(ctx, `insert into carts (customer_id, currency) values ($1, $2) on conflict (customer_id) do nothing`, customerID, currency)
+	if err != nil {
+		log.Print(err)
+		return nil, ErrInternal
+	}
+
+	//количество проверяем по итогу в корзине, цену запоминаем текущую
+	sqlStatement = `
+	insert into carts_items (customer_id, product_id, qty, price) values ($1, $2, $3, $4)
+	on conflict (customer_id, product_id) do update
+	set qty = case when $5 then carts_items.qty + excluded.qty else excluded.qty end,
+	price = excluded.price, updated = current_timestamp
+	returning qty`
+	total := 0
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		log.Print(err)
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	if err = tx.QueryRow(ctx, sqlStatement, customerID, productID, qty, current.Amount, add).Scan(&total); err != nil {
+		log.Print(err)
+		return nil, ErrInternal
+	}
+	if total > stock {
+		return nil, types.ErrOutOfStock
+	}
+	if err = tx.Commit(ctx); err != nil {
+		log.Print(err)
+		return nil, ErrInternal
+	}
+
+	return s.Cart(ctx, customerID)
+}
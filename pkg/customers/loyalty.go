@@ -0,0 +1,73 @@
+package customers
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+//Loyalty ... баллы клиента: Balance - доступно сейчас (без сгоревших), Expiring - сколько сгорит
+//ближайшим сроком Expires, Ledger - журнал начислений и списаний, новые сверху
+type Loyalty struct {
+	Balance  int             `json:"balance"`
+	Expiring int             `json:"expiring"`
+	Expires  *time.Time      `json:"expires"`
+	Ledger   []*LoyaltyEntry `json:"ledger"`
+}
+
+//LoyaltyEntry ... Kind - earn, redeem, expire или reverse; Points со знаком;
+//для начислений Remaining - сколько еще не потрачено, Expires - когда сгорит
+type LoyaltyEntry struct {
+	ID        int64      `json:"id"`
+	Kind      string     `json:"kind"`
+	Points    int        `json:"points"`
+	Remaining int        `json:"remaining"`
+	SaleID    *int64     `json:"sale_id"`
+	Expires   *time.Time `json:"expires"`
+	Created   time.Time  `json:"created"`
+}
+
+//Loyalty ... баланс и последние 200 записей журнала баллов клиента
+func (s *Service) Loyalty(ctx context.Context, customerID int64) (*Loyalty, error) {
+	item := &Loyalty{Ledger: make([]*LoyaltyEntry, 0)}
+
+	sqlStatement := `
+	select coalesce(sum(remaining),0),
+	coalesce(sum(remaining) filter (where expires = (select min(l.expires) from loyalty_ledger l
+		where l.customer_id = $1 and l.kind = 'earn' and l.remaining > 0 and l.expires > current_timestamp)),0),
+	min(expires)
+	from loyalty_ledger
+	where customer_id = $1 and kind = 'earn' and remaining > 0 and expires > current_timestamp`
+	err := s.db.QueryRow(ctx, sqlStatement, customerID).Scan(&item.Balance, &item.Expiring, &item.Expires)
+	if err != nil {
+		log.Print(err)
+		return nil, ErrInternal
+	}
+
+	sqlStatement = `
+	select id, kind, points, remaining, sale_id, expires, created
+	from loyalty_ledger where customer_id = $1
+	order by id desc limit 200`
+	rows, err := s.db.Query(ctx, sqlStatement, customerID)
+	if err != nil {
+		log.Print(err)
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry := &LoyaltyEntry{}
+		err = rows.Scan(&entry.ID, &entry.Kind, &entry.Points, &entry.Remaining, &entry.SaleID, &entry.Expires, &entry.Created)
+		if err != nil {
+			log.Print(err)
+			return nil, ErrInternal
+		}
+		item.Ledger = append(item.Ledger, entry)
+	}
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, ErrInternal
+	}
+
+	return item, nil
+}
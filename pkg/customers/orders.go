@@ -0,0 +1,160 @@
+package customers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/money"
+	"github.com/jackc/pgx/v4"
+)
+
+//Order ... покупка клиента: суммы в валюте покупки, Total - к оплате по позициям,
+//Paid - оплачено, Refunded - возвращено по возвратам
+type Order struct {
+	ID             int64            `json:"id"`
+	Status         string           `json:"status"`
+	Currency       string           `json:"currency"`
+	Coupon         string           `json:"coupon"`
+	CouponDiscount int              `json:"coupon_discount"`
+	Tax            int              `json:"tax"`
+	Total          int              `json:"total"`
+	Paid           int              `json:"paid"`
+	Refunded       int              `json:"refunded"`
+	Created        time.Time        `json:"created"`
+	Positions      []*OrderPosition `json:"positions"`
+	Returns        []*OrderReturn   `json:"returns"`
+}
+
+//OrderPosition ... Total - к оплате по позиции с учетом скидок и налога, Returned - сколько штук вернули
+type OrderPosition struct {
+	ID        int64       `json:"id"`
+	ProductID int64       `json:"product_id"`
+	Name      string      `json:"name"`
+	Price     money.Money `json:"price"`
+	Qty       int         `json:"qty"`
+	Discount  int         `json:"discount"`
+	Tax       int         `json:"tax"`
+	Total     int         `json:"total"`
+	Returned  int         `json:"returned"`
+}
+
+//OrderReturn ... возврат по покупке
+type OrderReturn struct {
+	ID      int64     `json:"id"`
+	Refund  int       `json:"refund"`
+	Created time.Time `json:"created"`
+}
+
+//черновики продаж - внутреннее дело менеджеров, клиенту их не показываем,
+//кроме его собственных заказов из корзины, которые ждут менеджера
+const orderColumns = `
+	s.id, s.status, s.currency, s.coupon, s.created,
+	coalesce((select r.amount from coupons_redemptions r where r.sale_id = s.id), 0),
+	coalesce((select sum(sp.tax) from sales_positions sp where sp.sale_id = s.id), 0),
+	coalesce((select sum(sp.net + sp.tax) from sales_positions sp where sp.sale_id = s.id), 0),
+	coalesce((select sum(pm.amount) from payments pm where pm.sale_id = s.id), 0),
+	coalesce((select sum(r.refund) from returns r where r.sale_id = s.id), 0)
+	from sales s
+	where s.customer_id = $1 and (s.status <> 'draft' or s.source = 'cart')`
+
+//Orders ... покупки клиента, новые сверху (без позиций)
+func (s *Service) Orders(ctx context.Context, customerID int64) ([]*Order, error) {
+	items := make([]*Order, 0)
+
+	rows, err := s.db.Query(ctx, `select `+orderColumns+` order by s.id desc limit 500`, customerID)
+	if err != nil {
+		log.Print(err)
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanOrder(rows)
+		if err != nil {
+			log.Print(err)
+			return nil, ErrInternal
+		}
+		items = append(items, item)
+	}
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, ErrInternal
+	}
+
+	return items, nil
+}
+
+//OrderByID ... покупка клиента с позициями и возвратами; чужая покупка не находится
+func (s *Service) OrderByID(ctx context.Context, customerID, id int64) (*Order, error) {
+	item, err := scanOrder(s.db.QueryRow(ctx, `select `+orderColumns+` and s.id = $2`, customerID, id))
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, ErrInternal
+	}
+
+	sqlStatement := `
+	select sp.id, sp.product_id, coalesce(p.name, ''), sp.price, sp.qty, sp.discount, sp.tax, sp.net + sp.tax,
+	coalesce((select sum(rp.qty) from returns_positions rp where rp.position_id = sp.id), 0)
+	from sales_positions sp
+	left join products p on p.id = sp.product_id
+	where sp.sale_id = $1
+	order by sp.id`
+	rows, err := s.db.Query(ctx, sqlStatement, item.ID)
+	if err != nil {
+		log.Print(err)
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		position := &OrderPosition{Price: money.Money{Currency: item.Currency}}
+		err = rows.Scan(&position.ID, &position.ProductID, &position.Name, &position.Price.Amount, &position.Qty,
+			&position.Discount, &position.Tax, &position.Total, &position.Returned)
+		if err != nil {
+			log.Print(err)
+			return nil, ErrInternal
+		}
+		item.Positions = append(item.Positions, position)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, ErrInternal
+	}
+
+	rows, err = s.db.Query(ctx, `select id, refund, created from returns where sale_id = $1 order by id`, item.ID)
+	if err != nil {
+		log.Print(err)
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		ret := &OrderReturn{}
+		if err = rows.Scan(&ret.ID, &ret.Refund, &ret.Created); err != nil {
+			log.Print(err)
+			return nil, ErrInternal
+		}
+		item.Returns = append(item.Returns, ret)
+	}
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, ErrInternal
+	}
+
+	return item, nil
+}
+
+func scanOrder(row pgx.Row) (*Order, error) {
+	item := &Order{Positions: make([]*OrderPosition, 0), Returns: make([]*OrderReturn, 0)}
+	err := row.Scan(&item.ID, &item.Status, &item.Currency, &item.Coupon, &item.Created,
+		&item.CouponDiscount, &item.Tax, &item.Total, &item.Paid, &item.Refunded)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
@@ -10,6 +10,8 @@ import (
 
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/FaranushKarimov/crud/pkg/money"
+	"github.com/FaranushKarimov/crud/pkg/types"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
@@ -51,19 +53,43 @@ type Customer struct {
 	Created  time.Time `json:"created"`
 }
 
-//Product ...
+//Product ... цена в валюте, которую запросил клиент
 type Product struct {
-	ID    int64  `json:"id"`
-	Name  string `json:"name"`
-	Price int    `json:"price"`
-	Qty   int    `json:"qty"`
+	ID     int64       `json:"id"`
+	Name   string      `json:"name"`
+	Price  money.Money `json:"price"`
+	Qty    int         `json:"qty"`
+	Images []*Image    `json:"images"`
+}
+
+//availableQty ... остаток товара p за вычетом действующих резервов под заказы - клиенту показываем его
+const availableQty = `greatest(p.qty - coalesce((select sum(sr.qty) from stock_reservations sr
+	where sr.product_id = p.id and sr.expires > current_timestamp),0), 0)`
+
+//Image ...
+type Image struct {
+	URL       string `json:"url"`
+	Thumbnail string `json:"thumbnail"`
+}
+
+//ProductDetail ... карточка товара
+type ProductDetail struct {
+	ID          int64                  `json:"id"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Category    string                 `json:"category"`
+	Price       money.Money            `json:"price"`
+	Qty         int                    `json:"qty"`
+	Available   bool                   `json:"available"`
+	Attributes  map[string]interface{} `json:"attributes"`
+	Images      []*Image               `json:"images"`
 }
 
 //All ....
 func (s *Service) All(ctx context.Context) (cs []*Customer, err error) {
 
 	//это наш sql запрос
-	sqlStatement := `select * from customers`
+	sqlStatement := `select id, name, phone, active, created from customers`
 
 	rows, err := s.db.Query(ctx, sqlStatement)
 	if err != nil {
@@ -93,7 +119,7 @@ func (s *Service) All(ctx context.Context) (cs []*Customer, err error) {
 func (s *Service) AllActive(ctx context.Context) (cs []*Customer, err error) {
 
 	//это наш sql запрос
-	sqlStatement := `select * from customers where active=true`
+	sqlStatement := `select id, name, phone, active, created from customers where active=true`
 
 	rows, err := s.db.Query(ctx, sqlStatement)
 	if err != nil {
@@ -124,7 +150,7 @@ func (s *Service) ByID(ctx context.Context, id int64) (*Customer, error) {
 	item := &Customer{}
 
 	//это наш sql запрос
-	sqlStatement := `select * from customers where id=$1`
+	sqlStatement := `select id, name, phone, active, created from customers where id=$1`
 	//выполняем запрос к базу
 	err := s.db.QueryRow(ctx, sqlStatement, id).Scan(
 		&item.ID,
@@ -151,7 +177,7 @@ func (s *Service) ChangeActive(ctx context.Context, id int64, active bool) (*Cus
 	item := &Customer{}
 
 	//это наш sql запрос
-	sqlStatement := `update customers set active=$2 where id=$1 returning *`
+	sqlStatement := `update customers set active=$2, version=version+1 where id=$1 returning id, name, phone, active, created`
 	//выполняем запрос к базу
 	err := s.db.QueryRow(ctx, sqlStatement, id, active).Scan(
 		&item.ID,
@@ -177,7 +203,7 @@ func (s *Service) Delete(ctx context.Context, id int64) (*Customer, error) {
 	item := &Customer{}
 
 	//это наш sql запрос
-	sqlStatement := `delete from customers  where id=$1 returning *`
+	sqlStatement := `delete from customers  where id=$1 returning id, name, phone, active, created`
 	//выполняем запрос к базу
 	err := s.db.QueryRow(ctx, sqlStatement, id).Scan(
 		&item.ID,
@@ -206,7 +232,7 @@ func (s *Service) Save(ctx context.Context, customer *Customer) (c *Customer, er
 	//если id равно то сделаем инцерт (тоест создаем и веренем только что созданный клиент)
 	if customer.ID == 0 {
 		//это наш sql запрос
-		sqlStatement := `insert into customers(name, phone, password) values($1, $2, $3) returning *`
+		sqlStatement := `insert into customers(name, phone, password) values($1, $2, $3) returning id, name, phone, password, active, created`
 		//выполняем запрос к базу
 		err = s.db.QueryRow(ctx, sqlStatement, customer.Name, customer.Phone, customer.Password).Scan(
 			&item.ID,
@@ -219,7 +245,7 @@ func (s *Service) Save(ctx context.Context, customer *Customer) (c *Customer, er
 	} else { //если нет обновляем и вернем обновленный
 
 		//это наш sql запрос
-		sqlStatement := `update customers set name=$1, phone=$2, password=$3 where id=$4 returning *`
+		sqlStatement := `update customers set name=$1, phone=$2, password=$3, version=version+1 where id=$4 returning id, name, phone, password, active, created`
 		//выполняем запрос к базу
 		err = s.db.QueryRow(ctx, sqlStatement, customer.Name, customer.Phone, customer.Password, customer.ID).Scan(
 			&item.ID,
@@ -278,13 +304,22 @@ func (s *Service) Token(ctx context.Context, phone, password string) (string, er
 
 }
 
-//Products ...
-func (s *Service) Products(ctx context.Context) ([]*Product, error) {
+//Products ... товары с ценами в валюте currency
+func (s *Service) Products(ctx context.Context, currency string) ([]*Product, error) {
 
 	items := make([]*Product, 0)
 
-	sqlStatement := `select id, name, price, qty from products where active = true order by id limit 500`
-	rows, err := s.db.Query(ctx, sqlStatement)
+	currency, rate, err := s.rate(ctx, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlStatement := `
+	select p.id, p.name, p.price, pp.price, ` + availableQty + `
+	from products p
+	left join products_prices pp on pp.product_id = p.id and pp.currency = $1
+	where p.active = true order by p.id limit 500`
+	rows, err := s.db.Query(ctx, sqlStatement, currency)
 
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -295,19 +330,138 @@ func (s *Service) Products(ctx context.Context) ([]*Product, error) {
 
 	defer rows.Close()
 
+	ids := make([]int64, 0)
 	for rows.Next() {
 		item := &Product{}
-		err = rows.Scan(&item.ID, &item.Name, &item.Price, &item.Qty)
+		var base int
+		var price *int
+		err = rows.Scan(&item.ID, &item.Name, &base, &price, &item.Qty)
 		if err != nil {
 			log.Print(err)
 			return nil, err
 		}
+		//цены в этой валюте нет и курса тоже нет - такой товар в этой валюте не продаем
+		var ok bool
+		if item.Price, ok = priceIn(base, price, currency, rate); !ok {
+			continue
+		}
 		items = append(items, item)
+		ids = append(ids, item.ID)
+	}
+	rows.Close()
+
+	images, err := s.productsImages(ctx, ids)
+	if err != nil {
+		log.Print(err)
+		return nil, ErrInternal
+	}
+	for _, item := range items {
+		item.Images = images[item.ID]
 	}
 
 	return items, nil
 }
 
+//ProductByID ... карточка активного товара с ценой в валюте currency
+func (s *Service) ProductByID(ctx context.Context, id int64, currency string) (*ProductDetail, error) {
+	item := &ProductDetail{}
+
+	currency, rate, err := s.rate(ctx, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlStatement := `
+	select p.id, p.name, p.description, p.category, p.price, pp.price, ` + availableQty + `, p.attributes
+	from products p
+	left join products_prices pp on pp.product_id = p.id and pp.currency = $2
+	where p.id = $1 and p.active = true`
+	var base int
+	var price *int
+	err = s.db.QueryRow(ctx, sqlStatement, id, currency).
+		Scan(&item.ID, &item.Name, &item.Description, &item.Category, &base, &price, &item.Qty, &item.Attributes)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, ErrInternal
+	}
+
+	var ok bool
+	if item.Price, ok = priceIn(base, price, currency, rate); !ok {
+		return nil, types.ErrNoExchangeRate
+	}
+	item.Available = item.Qty > 0
+
+	images, err := s.productsImages(ctx, []int64{item.ID})
+	if err != nil {
+		log.Print(err)
+		return nil, ErrInternal
+	}
+	item.Images = images[item.ID]
+
+	return item, nil
+}
+
+//productsImages ... картинки товаров по порядку, у внешних ссылок без уменьшенной копии Thumbnail = URL
+func (s *Service) productsImages(ctx context.Context, ids []int64) (map[int64][]*Image, error) {
+	images := make(map[int64][]*Image)
+
+	sqlStatement := `
+	select product_id, url, coalesce(nullif(thumbnail_url,''), url)
+	from products_images where product_id = any($1) order by product_id, position, id`
+	rows, err := s.db.Query(ctx, sqlStatement, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		item := &Image{}
+		if err = rows.Scan(&id, &item.URL, &item.Thumbnail); err != nil {
+			return nil, err
+		}
+		images[id] = append(images[id], item)
+	}
+
+	return images, rows.Err()
+}
+
+//rate ... нормализованный код валюты и её текущий курс (0 если курс не загружен)
+func (s *Service) rate(ctx context.Context, currency string) (string, float64, error) {
+	currency, err := money.Normalize(currency)
+	if err != nil {
+		return "", 0, err
+	}
+	if currency == money.Base {
+		return currency, 1, nil
+	}
+
+	var rate float64
+	err = s.db.QueryRow(ctx, `select rate from exchange_rates where currency = $1 order by created desc limit 1`, currency).Scan(&rate)
+	if err == pgx.ErrNoRows {
+		return currency, 0, nil
+	}
+	if err != nil {
+		log.Print(err)
+		return "", 0, ErrInternal
+	}
+	return currency, rate, nil
+}
+
+//priceIn ... явно заданная цена в валюте, иначе перевод из базовой по курсу
+func priceIn(base int, price *int, currency string, rate float64) (money.Money, bool) {
+	switch {
+	case price != nil:
+		return money.New(*price, currency), true
+	case rate > 0:
+		return money.FromBase(base, currency, rate), true
+	}
+	return money.Money{}, false
+}
+
 //IDByToken ....
 func (s *Service) IDByToken(ctx context.Context, token string) (int64, error) {
 	var id int64
@@ -0,0 +1,104 @@
+package managers
+
+import (
+	"context"
+	"log"
+
+	"github.com/FaranushKarimov/crud/pkg/types"
+)
+
+const (
+	//AttributeString ...
+	AttributeString = "string"
+	//AttributeNumber ...
+	AttributeNumber = "number"
+	//AttributeBoolean ...
+	AttributeBoolean = "boolean"
+)
+
+//Attribute ... описание характеристики товаров категории; характеристики без описания
+//сохраняются как есть, описанные проверяются по типу и обязательности
+type Attribute struct {
+	Category string `json:"category"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+}
+
+//SaveAttribute ...
+func (s *Service) SaveAttribute(ctx context.Context, item *Attribute) (*Attribute, error) {
+	if item.Category == "" || item.Name == "" {
+		return nil, types.ErrInvalidAttributes
+	}
+	switch item.Type {
+	case AttributeString, AttributeNumber, AttributeBoolean:
+	default:
+		return nil, types.ErrInvalidAttributes
+	}
+
+	sqlstmt := `insert into products_attributes(category,name,type,required) values ($1,$2,$3,$4)
+	on conflict (category,name) do update set type = excluded.type, required = excluded.required`
+	if _, err := s.db.Exec(ctx, sqlstmt, item.Category, item.Name, item.Type, item.Required); err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
+
+//Attributes ... схема характеристик категории
+func (s *Service) Attributes(ctx context.Context, category string) ([]*Attribute, error) {
+	items := make([]*Attribute, 0)
+
+	sqlstmt := `select category,name,type,required from products_attributes where category = $1 order by name`
+	rows, err := s.db.Query(ctx, sqlstmt, category)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Attribute{}
+		err = rows.Scan(&item.Category, &item.Name, &item.Type, &item.Required)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+//validateAttributes ... проверяет характеристики товара по схеме его категории
+func (s *Service) validateAttributes(ctx context.Context, category string, values map[string]interface{}) error {
+	schema, err := s.Attributes(ctx, category)
+	if err != nil {
+		return err
+	}
+
+	for _, attribute := range schema {
+		value, ok := values[attribute.Name]
+		if !ok || value == nil {
+			if attribute.Required {
+				return types.ErrInvalidAttributes
+			}
+			continue
+		}
+		//значения приходят из JSON, поэтому числа всегда float64
+		switch value.(type) {
+		case string:
+			ok = attribute.Type == AttributeString
+		case float64:
+			ok = attribute.Type == AttributeNumber
+		case bool:
+			ok = attribute.Type == AttributeBoolean
+		default:
+			ok = false
+		}
+		if !ok {
+			return types.ErrInvalidAttributes
+		}
+	}
+	return nil
+}
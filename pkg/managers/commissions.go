@@ -0,0 +1,176 @@
+package managers
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/jackc/pgx/v4"
+)
+
+//виды схем комиссии
+const (
+	CommissionFlat     = "flat"
+	CommissionTiered   = "tiered"
+	CommissionCategory = "category"
+)
+
+//CommissionTier ... ступень: при выполнении плана от From (в базисных пунктах, 10000 = 100%) ставка Rate
+type CommissionTier struct {
+	From int `json:"from"`
+	Rate int `json:"rate"`
+}
+
+//CommissionScheme ... схема комиссии менеджера; все ставки в базисных пунктах от выручки без налога:
+//flat - Rate, tiered - ставка ступени по выполнению плана, category - ставка категории товара (иначе Rate);
+//Active не передан при сохранении - не меняется
+type CommissionScheme struct {
+	ID         int64             `json:"id"`
+	Name       string            `json:"name"`
+	Kind       string            `json:"kind"`
+	Rate       int               `json:"rate"`
+	Tiers      []*CommissionTier `json:"tiers"`
+	Categories map[string]int    `json:"categories"`
+	Active     *bool             `json:"active"`
+	Created    time.Time         `json:"created"`
+}
+
+func (c *CommissionScheme) valid() bool {
+	if c.Name == "" || c.Rate < 0 || c.Rate > rateBase {
+		return false
+	}
+	switch c.Kind {
+	case CommissionFlat:
+	case CommissionTiered:
+		if len(c.Tiers) == 0 {
+			return false
+		}
+		for _, tier := range c.Tiers {
+			if tier.From < 0 || tier.Rate < 0 || tier.Rate > rateBase {
+				return false
+			}
+		}
+	case CommissionCategory:
+		for _, rate := range c.Categories {
+			if rate < 0 || rate > rateBase {
+				return false
+			}
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+//Commission ... комиссия по выручке revenue (по категориям товаров) при плане plan
+func (c *CommissionScheme) Commission(revenue map[string]int, plan int) int {
+	total := 0
+	for _, amount := range revenue {
+		total += amount
+	}
+
+	switch c.Kind {
+	case CommissionTiered:
+		attainment := 0
+		if plan > 0 {
+			attainment = total * rateBase / plan
+		}
+		rate := 0
+		for _, tier := range c.Tiers {
+			if attainment >= tier.From {
+				rate = tier.Rate
+			}
+		}
+		return divRound(total*rate, rateBase)
+	case CommissionCategory:
+		commission := 0
+		for category, amount := range revenue {
+			rate, ok := c.Categories[category]
+			if !ok {
+				rate = c.Rate
+			}
+			commission += divRound(amount*rate, rateBase)
+		}
+		return commission
+	default:
+		return divRound(total*c.Rate, rateBase)
+	}
+}
+
+//SaveCommissionScheme ...
+func (s *Service) SaveCommissionScheme(ctx context.Context, item *CommissionScheme) (*CommissionScheme, error) {
+	if !item.valid() {
+		return nil, types.ErrInvalidCommission
+	}
+	//ступени по возрастанию порога, чтобы брать последнюю достигнутую
+	sort.SliceStable(item.Tiers, func(i, j int) bool { return item.Tiers[i].From < item.Tiers[j].From })
+	if item.Tiers == nil {
+		item.Tiers = make([]*CommissionTier, 0)
+	}
+	if item.Categories == nil {
+		item.Categories = make(map[string]int)
+	}
+
+	var err error
+	if item.ID == 0 {
+		sqlstmt := `insert into commission_schemes(name,kind,rate,tiers,categories) values ($1,$2,$3,$4,$5) returning id,active,created`
+		err = s.db.QueryRow(ctx, sqlstmt, item.Name, item.Kind, item.Rate, item.Tiers, item.Categories).
+			Scan(&item.ID, &item.Active, &item.Created)
+	} else {
+		sqlstmt := `update commission_schemes set name=$2,kind=$3,rate=$4,tiers=$5,categories=$6,active=coalesce($7,active)
+		where id = $1 returning active,created`
+		err = s.db.QueryRow(ctx, sqlstmt, item.ID, item.Name, item.Kind, item.Rate, item.Tiers, item.Categories, item.Active).
+			Scan(&item.Active, &item.Created)
+	}
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
+
+//CommissionSchemes ...
+func (s *Service) CommissionSchemes(ctx context.Context) ([]*CommissionScheme, error) {
+	items := make([]*CommissionScheme, 0)
+
+	rows, err := s.db.Query(ctx, `select id,name,kind,rate,tiers,categories,active,created from commission_schemes order by id`)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &CommissionScheme{}
+		err = rows.Scan(&item.ID, &item.Name, &item.Kind, &item.Rate, &item.Tiers, &item.Categories, &item.Active, &item.Created)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+
+	return items, nil
+}
+
+//SetManagerCommission ... назначает менеджеру схему комиссии, schemeID == 0 снимает её
+func (s *Service) SetManagerCommission(ctx context.Context, managerID, schemeID int64) error {
+	tag, err := s.db.Exec(ctx, `update managers set commission_scheme_id = nullif($2, 0) where id = $1`, managerID, schemeID)
+	if err != nil {
+		log.Print(err)
+		return types.ErrInvalidCommission
+	}
+	if tag.RowsAffected() == 0 {
+		return types.ErrNotFound
+	}
+	return nil
+}
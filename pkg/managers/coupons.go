@@ -0,0 +1,246 @@
+package managers
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/money"
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/FaranushKarimov/crud/pkg/utils"
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	//CouponPercent ... скидка value процентов от суммы продажи
+	CouponPercent = "percent"
+	//CouponFixed ... фиксированная скидка value на всю продажу
+	CouponFixed = "fixed"
+
+	maxCouponBatch  = 1000
+	couponCodeLen   = 8
+	couponCodeTries = 5
+)
+
+//Coupon ... MaxUses и PerCustomer равные 0 означают "без ограничения"
+type Coupon struct {
+	ID          int64      `json:"id"`
+	Code        string     `json:"code"`
+	Kind        string     `json:"kind"`
+	Value       int        `json:"value"`
+	MaxUses     int        `json:"max_uses"`
+	PerCustomer int        `json:"per_customer"`
+	Used        int        `json:"used"`
+	Expires     *time.Time `json:"expires"`
+	Active      bool       `json:"active"`
+	Created     time.Time  `json:"created"`
+}
+
+//CouponBatch ... запрос на выпуск купонов: один купон с заданным Code или Count купонов со случайными кодами
+type CouponBatch struct {
+	Code        string     `json:"code"`
+	Prefix      string     `json:"prefix"`
+	Count       int        `json:"count"`
+	Kind        string     `json:"kind"`
+	Value       int        `json:"value"`
+	MaxUses     int        `json:"max_uses"`
+	PerCustomer int        `json:"per_customer"`
+	Expires     *time.Time `json:"expires"`
+}
+
+//CouponReport ... сколько раз и на какую сумму погашен купон
+type CouponReport struct {
+	CouponID    int64  `json:"coupon_id"`
+	Code        string `json:"code"`
+	MaxUses     int    `json:"max_uses"`
+	Used        int    `json:"used"`
+	Redemptions int    `json:"redemptions"`
+	Customers   int    `json:"customers"`
+	Amount      int    `json:"amount"`
+}
+
+//Discount ... сумма скидки по купону для продажи на сумму total в валюте currency;
+//фиксированная скидка задана в базовой валюте
+func (c *Coupon) Discount(total int, currency string, rate float64) int {
+	amount := 0
+	switch c.Kind {
+	case CouponPercent:
+		amount = total * c.Value / 100
+	case CouponFixed:
+		amount = money.FromBase(c.Value, currency, rate).Amount
+	}
+	if amount > total {
+		return total
+	}
+	return amount
+}
+
+func (b *CouponBatch) valid() bool {
+	if b.Code == "" && (b.Count <= 0 || b.Count > maxCouponBatch) {
+		return false
+	}
+	if b.MaxUses < 0 || b.PerCustomer < 0 {
+		return false
+	}
+	switch b.Kind {
+	case CouponPercent:
+		return b.Value > 0 && b.Value <= 100
+	case CouponFixed:
+		return b.Value > 0
+	}
+	return false
+}
+
+//CreateCoupons ... выпускает купоны одной транзакцией
+func (s *Service) CreateCoupons(ctx context.Context, batch *CouponBatch) ([]*Coupon, error) {
+	if !batch.valid() {
+		return nil, types.ErrInvalidCoupon
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	sqlstmt := `insert into coupons(code,kind,value,max_uses,per_customer,expires) values ($1,$2,$3,$4,$5,$6)
+	on conflict (code) do nothing returning id,code,kind,value,max_uses,per_customer,used,expires,active,created`
+
+	items := make([]*Coupon, 0)
+	if batch.Code != "" {
+		item := &Coupon{}
+		err = tx.QueryRow(ctx, sqlstmt, strings.ToUpper(batch.Code), batch.Kind, batch.Value, batch.MaxUses, batch.PerCustomer, batch.Expires).
+			Scan(&item.ID, &item.Code, &item.Kind, &item.Value, &item.MaxUses, &item.PerCustomer, &item.Used, &item.Expires, &item.Active, &item.Created)
+		if err == pgx.ErrNoRows {
+			return nil, types.ErrCouponCodeUsed
+		}
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+
+	for len(items) < batch.Count && batch.Code == "" {
+		//случайный код может совпасть с уже существующим, тогда пробуем еще раз
+		item := &Coupon{}
+		for try := 0; ; try++ {
+			code, err := utils.GenerateCode(couponCodeLen)
+			if err != nil {
+				return nil, err
+			}
+			err = tx.QueryRow(ctx, sqlstmt, strings.ToUpper(batch.Prefix)+code, batch.Kind, batch.Value, batch.MaxUses, batch.PerCustomer, batch.Expires).
+				Scan(&item.ID, &item.Code, &item.Kind, &item.Value, &item.MaxUses, &item.PerCustomer, &item.Used, &item.Expires, &item.Active, &item.Created)
+			if err == nil {
+				break
+			}
+			if err != pgx.ErrNoRows || try == couponCodeTries {
+				log.Print(err)
+				return nil, types.ErrInternal
+			}
+		}
+		items = append(items, item)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	return items, nil
+}
+
+//Coupons ...
+func (s *Service) Coupons(ctx context.Context) ([]*Coupon, error) {
+	items := make([]*Coupon, 0)
+
+	sqlstmt := `select id,code,kind,value,max_uses,per_customer,used,expires,active,created from coupons order by id desc limit 500`
+	rows, err := s.db.Query(ctx, sqlstmt)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Coupon{}
+		err = rows.Scan(&item.ID, &item.Code, &item.Kind, &item.Value, &item.MaxUses, &item.PerCustomer, &item.Used, &item.Expires, &item.Active, &item.Created)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+//CouponsReport ... отчет по погашениям в разрезе купонов
+func (s *Service) CouponsReport(ctx context.Context) ([]*CouponReport, error) {
+	items := make([]*CouponReport, 0)
+
+	sqlstmt := `
+	select c.id, c.code, c.max_uses, c.used, count(r.id), count(distinct r.customer_id), coalesce(sum(r.amount),0)
+	from coupons c
+	left join coupons_redemptions r on r.coupon_id = c.id
+	group by c.id
+	order by c.id desc
+	limit 500`
+	rows, err := s.db.Query(ctx, sqlstmt)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &CouponReport{}
+		err = rows.Scan(&item.CouponID, &item.Code, &item.MaxUses, &item.Used, &item.Redemptions, &item.Customers, &item.Amount)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+//redeemCoupon ... атомарно увеличивает счетчик использований, если купон еще можно применить;
+//ограничение на покупателя к анонимной продаже (customerID == 0) не применяется;
+//строка купона блокируется до подсчета погашений покупателя: в read committed подзапрос внутри
+//update видит снимок на начало запроса и пропустил бы погашение параллельной продажи
+//того же покупателя, а следующий запрос после блокировки уже видит его
+func redeemCoupon(ctx context.Context, q querier, code string, customerID int64) (*Coupon, error) {
+	item := &Coupon{}
+
+	var id int64
+	err := q.QueryRow(ctx, `select id from coupons where code = $1 for update`, strings.ToUpper(code)).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrInvalidCoupon
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	sqlstmt := `
+	update coupons c set used = c.used + 1
+	where c.id = $1 and c.active
+	and (c.expires is null or c.expires > current_timestamp)
+	and (c.max_uses = 0 or c.used < c.max_uses)
+	and (c.per_customer = 0 or $2::bigint = 0 or
+		c.per_customer > (select count(*) from coupons_redemptions r where r.coupon_id = c.id and r.customer_id = $2))
+	returning c.id,c.code,c.kind,c.value,c.max_uses,c.per_customer,c.used,c.expires,c.active,c.created`
+	err = q.QueryRow(ctx, sqlstmt, id, customerID).
+		Scan(&item.ID, &item.Code, &item.Kind, &item.Value, &item.MaxUses, &item.PerCustomer, &item.Used, &item.Expires, &item.Active, &item.Created)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrInvalidCoupon
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
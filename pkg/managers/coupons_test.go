@@ -0,0 +1,99 @@
+package managers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/types"
+)
+
+func TestRedeemCouponPerCustomerConcurrent(t *testing.T) {
+	s := testService(t)
+	ctx := context.Background()
+	const buyers = 10
+
+	managerID := testManager(t, s)
+	customerID := testCustomer(t, s)
+	productID := testProduct(t, s, 100, buyers)
+	code := fmt.Sprintf("T%d", time.Now().UnixNano())
+	_, err := s.db.Exec(ctx, `insert into coupons (code,kind,value,per_customer) values ($1,'percent',10,1)`, code)
+	if err != nil {
+		t.Fatalf("insert coupon: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	redeemed := 0
+	for i := 0; i < buyers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.MakeSale(ctx, &Sale{
+				ManagerID:  managerID,
+				CustomerID: customerID,
+				Coupon:     code,
+				Positions:  []*SalePosition{{ProductID: productID, Qty: 1}},
+			})
+			if err == types.ErrInvalidCoupon {
+				return
+			}
+			if err != nil {
+				t.Errorf("MakeSale: %v", err)
+				return
+			}
+			mu.Lock()
+			redeemed++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if redeemed != 1 {
+		t.Errorf("redeemed = %d, want 1 for per_customer = 1", redeemed)
+	}
+	count := 0
+	err = s.db.QueryRow(ctx, `select count(*) from coupons_redemptions r join coupons c on c.id = r.coupon_id where c.code = $1`, code).Scan(&count)
+	if err != nil {
+		t.Fatalf("select redemptions: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("redemptions = %d, want 1", count)
+	}
+}
+
+func TestRedeemCouponAnonymous(t *testing.T) {
+	s := testService(t)
+	ctx := context.Background()
+
+	managerID := testManager(t, s)
+	productID := testProduct(t, s, 100, 5)
+	code := fmt.Sprintf("T%d", time.Now().UnixNano())
+	_, err := s.db.Exec(ctx, `insert into coupons (code,kind,value,per_customer) values ($1,'percent',10,1)`, code)
+	if err != nil {
+		t.Fatalf("insert coupon: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		sale, err := s.MakeSale(ctx, &Sale{
+			ManagerID: managerID,
+			Anonymous: true,
+			Coupon:    code,
+			Positions: []*SalePosition{{ProductID: productID, Qty: 1}},
+		})
+		if err != nil {
+			t.Fatalf("MakeSale #%d: %v", i+1, err)
+		}
+
+		var customerID *int64
+		err = s.db.QueryRow(ctx, `select customer_id from coupons_redemptions where sale_id = $1`, sale.ID).Scan(&customerID)
+		if err != nil {
+			t.Fatalf("select redemption: %v", err)
+		}
+		if customerID != nil {
+			t.Errorf("redemption customer_id = %d, want null", *customerID)
+		}
+	}
+}
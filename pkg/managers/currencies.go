@@ -0,0 +1,136 @@
+package managers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/money"
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/jackc/pgx/v4"
+)
+
+//ExchangeRate ... Rate - сколько единиц базовой валюты стоит одна единица Currency
+type ExchangeRate struct {
+	Currency string    `json:"currency"`
+	Rate     float64   `json:"rate"`
+	Created  time.Time `json:"created"`
+}
+
+//SaveExchangeRates ... загружает новые курсы, старые остаются в истории
+func (s *Service) SaveExchangeRates(ctx context.Context, items []*ExchangeRate) ([]*ExchangeRate, error) {
+	for _, item := range items {
+		currency, err := money.Normalize(item.Currency)
+		if err != nil {
+			return nil, err
+		}
+		if currency == money.Base || item.Rate <= 0 {
+			return nil, types.ErrUnknownCurrency
+		}
+		item.Currency = currency
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	for _, item := range items {
+		err = tx.QueryRow(ctx, `insert into exchange_rates(currency,rate) values ($1,$2) returning created`,
+			item.Currency, item.Rate).Scan(&item.Created)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	return items, nil
+}
+
+//ExchangeRates ... последние загруженные курсы по каждой валюте
+func (s *Service) ExchangeRates(ctx context.Context) ([]*ExchangeRate, error) {
+	items := make([]*ExchangeRate, 0)
+
+	sqlstmt := `select distinct on (currency) currency, rate, created from exchange_rates order by currency, created desc`
+	rows, err := s.db.Query(ctx, sqlstmt)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &ExchangeRate{}
+		err = rows.Scan(&item.Currency, &item.Rate, &item.Created)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+//exchangeRate ... текущий курс валюты, для базовой валюты всегда 1
+func (s *Service) exchangeRate(ctx context.Context, currency string) (float64, error) {
+	if currency == money.Base {
+		return 1, nil
+	}
+
+	var rate float64
+	sqlstmt := `select rate from exchange_rates where currency = $1 order by created desc limit 1`
+	err := s.db.QueryRow(ctx, sqlstmt, currency).Scan(&rate)
+	if err == pgx.ErrNoRows {
+		return 0, types.ErrNoExchangeRate
+	}
+	if err != nil {
+		log.Print(err)
+		return 0, types.ErrInternal
+	}
+	return rate, nil
+}
+
+//productsPrices ... явно заданные цены товаров в других валютах
+func (s *Service) productsPrices(ctx context.Context, ids []int64) (map[int64][]money.Money, error) {
+	prices := make(map[int64][]money.Money)
+
+	sqlstmt := `select product_id, currency, price from products_prices where product_id = any($1) order by product_id, currency`
+	rows, err := s.db.Query(ctx, sqlstmt, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		price := money.Money{}
+		if err = rows.Scan(&id, &price.Currency, &price.Amount); err != nil {
+			return nil, err
+		}
+		prices[id] = append(prices[id], price)
+	}
+
+	return prices, rows.Err()
+}
+
+//savePrices ... заменяет цены товара в других валютах на переданные
+func savePrices(ctx context.Context, tx pgx.Tx, product *Product) error {
+	if _, err := tx.Exec(ctx, `delete from products_prices where product_id = $1`, product.ID); err != nil {
+		return err
+	}
+	for _, price := range product.Prices {
+		_, err := tx.Exec(ctx, `insert into products_prices(product_id,currency,price) values ($1,$2,$3)`,
+			product.ID, price.Currency, price.Amount)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package managers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/FaranushKarimov/crud/pkg/types"
+)
+
+func TestRemoveCustomerWithCart(t *testing.T) {
+	s := testService(t)
+	ctx := context.Background()
+
+	customerID := testCustomer(t, s)
+	productID := testProduct(t, s, 100, 5)
+	if _, err := s.db.Exec(ctx, `insert into carts (customer_id) values ($1)`, customerID); err != nil {
+		t.Fatalf("insert cart: %v", err)
+	}
+	_, err := s.db.Exec(ctx, `insert into carts_items (customer_id,product_id,qty,price) values ($1,$2,1,100)`, customerID, productID)
+	if err != nil {
+		t.Fatalf("insert cart item: %v", err)
+	}
+
+	if err = s.RemoveCustomerByID(ctx, customerID); err != nil {
+		t.Fatalf("RemoveCustomerByID: %v", err)
+	}
+	if _, err = s.CustomerByID(ctx, customerID); err != types.ErrNotFound {
+		t.Errorf("CustomerByID err = %v, want %v", err, types.ErrNotFound)
+	}
+}
+
+func TestRemoveCustomerWithLoyaltyHistory(t *testing.T) {
+	s := testService(t)
+	ctx := context.Background()
+
+	customerID := testCustomer(t, s)
+	_, err := s.db.Exec(ctx, `insert into loyalty_ledger (customer_id,kind,points) values ($1,$2,0)`, customerID, LoyaltyExpire)
+	if err != nil {
+		t.Fatalf("insert ledger: %v", err)
+	}
+
+	if err = s.RemoveCustomerByID(ctx, customerID); err != types.ErrCustomerInUse {
+		t.Errorf("RemoveCustomerByID err = %v, want %v", err, types.ErrCustomerInUse)
+	}
+}
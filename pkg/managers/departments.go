@@ -0,0 +1,355 @@
+package managers
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/jackc/pgx/v4"
+)
+
+//Department ... отдел: HeadID - руководитель отдела (0 - не назначен), Budget - месячный бюджет,
+//Plan - план продаж на текущий месяц (последний заданный), суммы в минимальных единицах базовой валюты
+type Department struct {
+	ID       int64     `json:"id"`
+	Name     string    `json:"name"`
+	HeadID   int64     `json:"head_id"`
+	HeadName string    `json:"head_name"`
+	Budget   int       `json:"budget"`
+	Plan     int       `json:"plan"`
+	Active   bool      `json:"active"`
+	Managers []*Member `json:"managers,omitempty"`
+	Count    int       `json:"count"`
+	Created  time.Time `json:"created"`
+}
+
+//Member ... менеджер отдела
+type Member struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	BossID int64  `json:"boss_id"`
+	Active bool   `json:"active"`
+}
+
+//DepartmentPlan ... план продаж отдела на месяц Period (формат 2006-01), как и у менеджеров
+//ставится на выручку без налога и действует последний заданный
+type DepartmentPlan struct {
+	ID           int64     `json:"id"`
+	DepartmentID int64     `json:"department_id"`
+	Period       string    `json:"period"`
+	Amount       int       `json:"amount"`
+	CreatedBy    int64     `json:"created_by"`
+	Created      time.Time `json:"created"`
+}
+
+//DepartmentProgress ... продажи отдела за месяц против плана и бюджета; Actual - выручка без налога
+//(база планов), Units и Sales - как в отчете по продажам
+type DepartmentProgress struct {
+	ID       int64   `json:"id"`
+	Name     string  `json:"name"`
+	HeadID   int64   `json:"head_id"`
+	Budget   int     `json:"budget"`
+	Plan     int     `json:"plan"`
+	Actual   int     `json:"actual"`
+	Units    int     `json:"units"`
+	Sales    int     `json:"sales"`
+	Percent  float64 `json:"percent"`
+	Forecast int     `json:"forecast"`
+}
+
+//departmentColumns ... отдел с руководителем, планом на месяц $1 и числом менеджеров
+const departmentColumns = `
+	d.id, d.name, coalesce(d.head_id, 0), coalesce(h.name, ''), d.budget,
+	coalesce((select dp.amount from departments_plans dp where dp.department_id = d.id and dp.period = $1 order by dp.id desc limit 1), 0),
+	d.active, (select count(*) from managers m where m.department_id = d.id), d.created
+	from departments d
+	left join managers h on h.id = d.head_id`
+
+//Departments ... все отделы по названию, план - на текущий месяц
+func (s *Service) Departments(ctx context.Context) ([]*Department, error) {
+	items := make([]*Department, 0)
+
+	rows, err := s.db.Query(ctx, `select `+departmentColumns+` order by d.name`, currentPeriod())
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanDepartment(rows)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+	return items, nil
+}
+
+//DepartmentByID ... отдел со списком менеджеров
+func (s *Service) DepartmentByID(ctx context.Context, id int64) (*Department, error) {
+	item, err := scanDepartment(s.db.QueryRow(ctx, `select `+departmentColumns+` where d.id = $2`, currentPeriod(), id))
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	item.Managers = make([]*Member, 0)
+	rows, err := s.db.Query(ctx, `select id, name, coalesce(boss_id, 0), active from managers where department_id = $1 order by name, id`, id)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		member := &Member{}
+		if err = rows.Scan(&member.ID, &member.Name, &member.BossID, &member.Active); err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		item.Managers = append(item.Managers, member)
+	}
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
+
+//SaveDepartment ... создает (ID == 0, новый отдел всегда активный) или меняет отдел;
+//название уникально без учета регистра, руководитель должен быть активным менеджером
+func (s *Service) SaveDepartment(ctx context.Context, item *Department) (*Department, error) {
+	item.Name = strings.TrimSpace(item.Name)
+	if item.Name == "" || item.Budget < 0 {
+		return nil, types.ErrInvalidDepartment
+	}
+	if item.HeadID != 0 {
+		active := false
+		err := s.db.QueryRow(ctx, `select active from managers where id = $1`, item.HeadID).Scan(&active)
+		if err == pgx.ErrNoRows || err == nil && !active {
+			return nil, types.ErrInvalidDepartment
+		}
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+	}
+
+	used := false
+	err := s.db.QueryRow(ctx, `select exists(select 1 from departments where lower(name) = lower($1) and id <> $2)`, item.Name, item.ID).Scan(&used)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	if used {
+		return nil, types.ErrDepartmentNameUsed
+	}
+
+	if item.ID == 0 {
+		item.Active = true
+		sqlstmt := `insert into departments (name, head_id, budget, active) values ($1, nullif($2, 0), $3, $4) returning id`
+		err = s.db.QueryRow(ctx, sqlstmt, item.Name, item.HeadID, item.Budget, item.Active).Scan(&item.ID)
+	} else {
+		sqlstmt := `update departments set name = $2, head_id = nullif($3, 0), budget = $4, active = $5 where id = $1 returning id`
+		err = s.db.QueryRow(ctx, sqlstmt, item.ID, item.Name, item.HeadID, item.Budget, item.Active).Scan(&item.ID)
+	}
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	return s.DepartmentByID(ctx, item.ID)
+}
+
+//AssignDepartment ... переводит менеджера в отдел, departmentID 0 - убирает из отдела
+func (s *Service) AssignDepartment(ctx context.Context, managerID, departmentID int64) (*Member, error) {
+	if departmentID != 0 {
+		active := false
+		err := s.db.QueryRow(ctx, `select active from departments where id = $1`, departmentID).Scan(&active)
+		if err == pgx.ErrNoRows || err == nil && !active {
+			return nil, types.ErrInvalidDepartment
+		}
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+	}
+
+	item := &Member{}
+	sqlstmt := `update managers set department_id = nullif($2, 0) where id = $1 returning id, name, coalesce(boss_id, 0), active`
+	err := s.db.QueryRow(ctx, sqlstmt, managerID, departmentID).Scan(&item.ID, &item.Name, &item.BossID, &item.Active)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
+
+//SaveDepartmentPlan ... задает план отдела на месяц, прежние значения остаются в истории
+func (s *Service) SaveDepartmentPlan(ctx context.Context, plan *DepartmentPlan) (*DepartmentPlan, error) {
+	period, err := time.ParseInLocation("2006-01", plan.Period, time.Local)
+	if err != nil || plan.Amount < 0 || plan.DepartmentID == 0 {
+		return nil, types.ErrInvalidPlan
+	}
+
+	sqlstmt := `
+	insert into departments_plans (department_id, period, amount, created_by)
+	select id, $2, $3, $4 from departments where id = $1
+	returning id, created`
+	err = s.db.QueryRow(ctx, sqlstmt, plan.DepartmentID, period, plan.Amount, plan.CreatedBy).Scan(&plan.ID, &plan.Created)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	return plan, nil
+}
+
+//DepartmentPlans ... история планов отдела, новые сверху
+func (s *Service) DepartmentPlans(ctx context.Context, departmentID int64) ([]*DepartmentPlan, error) {
+	items := make([]*DepartmentPlan, 0)
+
+	sqlstmt := `
+	select id, department_id, to_char(period, 'YYYY-MM'), amount, coalesce(created_by, 0), created
+	from departments_plans
+	where department_id = $1
+	order by period desc, id desc`
+	rows, err := s.db.Query(ctx, sqlstmt, departmentID)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &DepartmentPlan{}
+		err = rows.Scan(&item.ID, &item.DepartmentID, &item.Period, &item.Amount, &item.CreatedBy, &item.Created)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+	return items, nil
+}
+
+//DepartmentsProgress ... выручка отделов за месяц period (формат 2006-01) на момент now против плана
+//и бюджета; продажи менеджеров без отдела идут строкой с ID 0
+func (s *Service) DepartmentsProgress(ctx context.Context, period string, now time.Time) ([]*DepartmentProgress, error) {
+	from, err := time.ParseInLocation("2006-01", period, time.Local)
+	if err != nil {
+		return nil, types.ErrInvalidPlan
+	}
+	to := from.AddDate(0, 1, 0)
+
+	items := make([]*DepartmentProgress, 0)
+	byID := make(map[int64]*DepartmentProgress)
+
+	rows, err := s.db.Query(ctx, `select `+departmentColumns+` order by d.name`, from)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	for rows.Next() {
+		department, err := scanDepartment(rows)
+		if err != nil {
+			rows.Close()
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		item := &DepartmentProgress{ID: department.ID, Name: department.Name, HeadID: department.HeadID, Budget: department.Budget, Plan: department.Plan}
+		byID[item.ID] = item
+		items = append(items, item)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+
+	sales, err := s.SalesReport(ctx, GroupDepartment, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range sales.Rows {
+		id, _ := strconv.ParseInt(row.Key, 10, 64)
+		item, ok := byID[id]
+		if !ok {
+			item = &DepartmentProgress{ID: id, Name: row.Name}
+			byID[id] = item
+			items = append(items, item)
+		}
+		item.Units, item.Sales = row.Units, row.Sales
+	}
+
+	revenue, err := netRevenue(ctx, s.db, from, to)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	rows, err = s.db.Query(ctx, `select id, coalesce(department_id, 0) from managers where id = any($1)`, revenueManagers(revenue))
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var managerID, departmentID int64
+		if err = rows.Scan(&managerID, &departmentID); err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		item, ok := byID[departmentID]
+		if !ok {
+			item = &DepartmentProgress{ID: departmentID}
+			byID[departmentID] = item
+			items = append(items, item)
+		}
+		item.Actual += revenueTotal(revenue[managerID])
+	}
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+
+	for _, item := range items {
+		item.Percent = percentOf(item.Actual, item.Plan)
+		item.Forecast = forecast(item.Actual, from, to, now)
+	}
+	return items, nil
+}
+
+func scanDepartment(row pgx.Row) (*Department, error) {
+	item := &Department{}
+	err := row.Scan(&item.ID, &item.Name, &item.HeadID, &item.HeadName, &item.Budget, &item.Plan, &item.Active, &item.Count, &item.Created)
+	return item, err
+}
+
+//currentPeriod ... первое число текущего месяца
+func currentPeriod() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+}
@@ -0,0 +1,86 @@
+package managers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/jackc/pgx/v4"
+)
+
+//виды документов по продаже
+const (
+	DocumentReceipt = "receipt"
+	DocumentInvoice = "invoice"
+)
+
+//Document ... документ по продаже; Number - сквозной номер без пропусков внутри вида документа
+type Document struct {
+	ID      int64     `json:"id"`
+	SaleID  int64     `json:"sale_id"`
+	Kind    string    `json:"kind"`
+	Number  int64     `json:"number"`
+	Created time.Time `json:"created"`
+}
+
+//IssueDocument ... выдает документ вида kind по проведенной продаже; повторный запрос
+//возвращает уже выданный документ с тем же номером
+func (s *Service) IssueDocument(ctx context.Context, saleID int64, kind string) (*Document, error) {
+	if kind != DocumentReceipt && kind != DocumentInvoice {
+		return nil, types.ErrInvalidDocument
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	status := ""
+	err = tx.QueryRow(ctx, `select status from sales where id = $1 for update`, saleID).Scan(&status)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	item := &Document{SaleID: saleID, Kind: kind}
+	err = tx.QueryRow(ctx, `select id, number, created from documents where sale_id = $1 and kind = $2`, saleID, kind).
+		Scan(&item.ID, &item.Number, &item.Created)
+	if err == nil {
+		return item, nil
+	}
+	if err != pgx.ErrNoRows {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	if status != SaleConfirmed && status != SalePaid {
+		return nil, types.ErrSaleStatus
+	}
+
+	//счетчик в отдельной строке, а не sequence: номер берется под блокировкой и откатывается вместе с транзакцией
+	sqlstmt := `
+	insert into documents_counters (kind, last) values ($1, 1)
+	on conflict (kind) do update set last = documents_counters.last + 1
+	returning last`
+	if err = tx.QueryRow(ctx, sqlstmt, kind).Scan(&item.Number); err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	sqlstmt = `insert into documents (sale_id, kind, number) values ($1, $2, $3) returning id, created`
+	if err = tx.QueryRow(ctx, sqlstmt, saleID, kind, item.Number).Scan(&item.ID, &item.Created); err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
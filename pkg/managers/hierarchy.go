@@ -0,0 +1,275 @@
+package managers
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/money"
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/jackc/pgx/v4"
+)
+
+//OrgNode ... менеджер в оргструктуре: BossID 0 - без руководителя, Depth - уровень относительно
+//того, от кого строим (1 - прямые подчиненные), Children заполняются только в дереве
+type OrgNode struct {
+	ID          int64      `json:"id"`
+	Name        string     `json:"name"`
+	Departament string     `json:"departament"`
+	BossID      int64      `json:"boss_id"`
+	Active      bool       `json:"active"`
+	Depth       int        `json:"depth"`
+	Children    []*OrgNode `json:"children,omitempty"`
+}
+
+//TeamMemberSales ... продажи менеджера за период: Revenue, Units и Sales - его собственные,
+//Team* - вместе со всеми его подчиненными; выручка в базовой валюте за вычетом возвратов
+type TeamMemberSales struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	BossID      int64  `json:"boss_id"`
+	Depth       int    `json:"depth"`
+	Revenue     int    `json:"revenue"`
+	Units       int    `json:"units"`
+	Sales       int    `json:"sales"`
+	TeamRevenue int    `json:"team_revenue"`
+	TeamUnits   int    `json:"team_units"`
+	TeamSales   int    `json:"team_sales"`
+}
+
+//TeamSales ... свод продаж команды руководителя BossID (он сам первый в Members) за период [From, To)
+type TeamSales struct {
+	BossID   int64              `json:"boss_id"`
+	From     time.Time          `json:"from"`
+	To       time.Time          `json:"to"`
+	Currency string             `json:"currency"`
+	Members  []*TeamMemberSales `json:"members"`
+}
+
+//hierarchyLock ... ключ advisory lock, под которым меняются руководители (чтобы параллельно не собрать цикл)
+const hierarchyLock = 4049
+
+//subordinatesQuery ... все подчиненные $1 рекурсивно; path защищает от циклов в старых данных
+const subordinatesQuery = `
+	with recursive team as (
+		select m.id, m.name, coalesce(d.name, '') departament, m.boss_id, m.active, 1 depth, array[$1::bigint, m.id] path
+		from managers m left join departments d on d.id = m.department_id
+		where m.boss_id = $1
+		union all
+		select m.id, m.name, coalesce(d.name, ''), m.boss_id, m.active, t.depth + 1, t.path || m.id
+		from managers m join team t on m.boss_id = t.id
+		left join departments d on d.id = m.department_id
+		where not m.id = any(t.path)
+	)
+	select id, name, departament, boss_id, active, depth from team`
+
+//SetBoss ... назначает менеджеру руководителя, bossID 0 убирает руководителя;
+//руководитель должен быть активным и не может быть подчиненным этого менеджера
+func (s *Service) SetBoss(ctx context.Context, managerID, bossID int64) (*OrgNode, error) {
+	if managerID == bossID {
+		return nil, types.ErrHierarchyCycle
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, `select pg_advisory_xact_lock($1)`, hierarchyLock); err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	if bossID != 0 {
+		active := false
+		err = tx.QueryRow(ctx, `select active from managers where id = $1`, bossID).Scan(&active)
+		if err == pgx.ErrNoRows || err == nil && !active {
+			return nil, types.ErrInvalidBoss
+		}
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+
+		cycle := false
+		err = tx.QueryRow(ctx, `select exists(`+subordinatesQuery+` where id = $2)`, managerID, bossID).Scan(&cycle)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		if cycle {
+			return nil, types.ErrHierarchyCycle
+		}
+	}
+
+	item := &OrgNode{}
+	var boss *int64
+	sqlstmt := `update managers set boss_id = nullif($2, 0) where id = $1
+	returning id, name, coalesce((select d.name from departments d where d.id = department_id), ''), boss_id, active`
+	err = tx.QueryRow(ctx, sqlstmt, managerID, bossID).Scan(&item.ID, &item.Name, &item.Departament, &boss, &item.Active)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	if boss != nil {
+		item.BossID = *boss
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
+
+//Subordinates ... подчиненные менеджера: только прямые (direct) или все уровни, по уровням и id
+func (s *Service) Subordinates(ctx context.Context, managerID int64, direct bool) ([]*OrgNode, error) {
+	items := make([]*OrgNode, 0)
+
+	sqlstmt := subordinatesQuery + ` where $2 = false or depth = 1 order by depth, id`
+	rows, err := s.db.Query(ctx, sqlstmt, managerID, direct)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &OrgNode{}
+		if err = rows.Scan(&item.ID, &item.Name, &item.Departament, &item.BossID, &item.Active, &item.Depth); err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+	return items, nil
+}
+
+//IsSubordinate ... managerID подчиняется bossID напрямую или через других руководителей
+func (s *Service) IsSubordinate(ctx context.Context, bossID, managerID int64) (bool, error) {
+	found := false
+	err := s.db.QueryRow(ctx, `select exists(`+subordinatesQuery+` where id = $2)`, bossID, managerID).Scan(&found)
+	if err != nil {
+		log.Print(err)
+		return false, types.ErrInternal
+	}
+	return found, nil
+}
+
+//OrgChart ... дерево оргструктуры от менеджера rootID, при rootID 0 - от всех менеджеров без руководителя
+func (s *Service) OrgChart(ctx context.Context, rootID int64) ([]*OrgNode, error) {
+	roots := make([]*OrgNode, 0)
+
+	const columns = `select m.id, m.name, coalesce(d.name, ''), coalesce(m.boss_id, 0), m.active
+	from managers m left join departments d on d.id = m.department_id`
+	sqlstmt := columns + ` where m.boss_id is null order by m.id`
+	args := []interface{}{}
+	if rootID != 0 {
+		sqlstmt = columns + ` where m.id = $1`
+		args = append(args, rootID)
+	}
+	rows, err := s.db.Query(ctx, sqlstmt, args...)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	for rows.Next() {
+		item := &OrgNode{}
+		if err = rows.Scan(&item.ID, &item.Name, &item.Departament, &item.BossID, &item.Active); err != nil {
+			rows.Close()
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		roots = append(roots, item)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+	if rootID != 0 && len(roots) == 0 {
+		return nil, types.ErrNotFound
+	}
+
+	//подчиненные идут по уровням, поэтому руководитель всегда уже в дереве
+	for _, root := range roots {
+		nodes := map[int64]*OrgNode{root.ID: root}
+		subordinates, err := s.Subordinates(ctx, root.ID, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range subordinates {
+			boss, ok := nodes[item.BossID]
+			if !ok {
+				continue
+			}
+			boss.Children = append(boss.Children, item)
+			nodes[item.ID] = item
+		}
+	}
+	return roots, nil
+}
+
+//TeamSales ... продажи руководителя и всей его команды за период с суммированием снизу вверх по дереву
+func (s *Service) TeamSales(ctx context.Context, bossID int64, from, to time.Time) (*TeamSales, error) {
+	boss := &TeamMemberSales{ID: bossID}
+	var bossBoss *int64
+	err := s.db.QueryRow(ctx, `select name, boss_id from managers where id = $1`, bossID).Scan(&boss.Name, &bossBoss)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	if bossBoss != nil {
+		boss.BossID = *bossBoss
+	}
+
+	subordinates, err := s.Subordinates(ctx, bossID, false)
+	if err != nil {
+		return nil, err
+	}
+	report, err := s.SalesReport(ctx, GroupManager, from, to)
+	if err != nil {
+		return nil, err
+	}
+	byManager := make(map[string]*ReportRow)
+	for _, row := range report.Rows {
+		byManager[row.Key] = row
+	}
+
+	team := &TeamSales{BossID: bossID, From: from, To: to, Currency: money.Base, Members: []*TeamMemberSales{boss}}
+	for _, item := range subordinates {
+		team.Members = append(team.Members, &TeamMemberSales{ID: item.ID, Name: item.Name, BossID: item.BossID, Depth: item.Depth})
+	}
+
+	members := make(map[int64]*TeamMemberSales)
+	for _, member := range team.Members {
+		members[member.ID] = member
+		if row, ok := byManager[strconv.FormatInt(member.ID, 10)]; ok {
+			member.Revenue, member.Units, member.Sales = row.Revenue, row.Units, row.Sales
+		}
+		member.TeamRevenue, member.TeamUnits, member.TeamSales = member.Revenue, member.Units, member.Sales
+	}
+	//с нижних уровней вверх: у каждого уже посчитана вся его ветка
+	for i := len(team.Members) - 1; i > 0; i-- {
+		member := team.Members[i]
+		if parent, ok := members[member.BossID]; ok {
+			parent.TeamRevenue += member.TeamRevenue
+			parent.TeamUnits += member.TeamUnits
+			parent.TeamSales += member.TeamSales
+		}
+	}
+	return team, nil
+}
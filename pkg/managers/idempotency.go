@@ -0,0 +1,75 @@
+package managers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/jackc/pgx/v4"
+)
+
+//idempotencyLease ... сколько ключ считается занятым выполняющимся запросом; если ответ так и не сохранили
+//(процесс упал посреди запроса), по истечении срока ключ можно занять заново
+const idempotencyLease = time.Minute
+
+//ClaimIdempotencyKey ... занимает ключ key менеджера owner под запрос с хешем hash и возвращает nil, nil;
+//если ключ уже использован не позже чем window назад - возвращает сохраненный ответ,
+//types.ErrIdempotencyMismatch для другого запроса или types.ErrIdempotencyInProgress если ответа еще нет
+func (s *Service) ClaimIdempotencyKey(ctx context.Context, owner int64, key, hash string, window time.Duration) (*types.StoredResponse, error) {
+	//просроченный ключ или брошенный без ответа дольше idempotencyLease занимаем заново
+	sqlstmt := `
+	insert into idempotency_keys (owner_id, key, request_hash) values ($1, $2, $3)
+	on conflict (owner_id, key) do update
+	set request_hash = excluded.request_hash, status = 0, headers = '{}', body = null, created = current_timestamp
+	where idempotency_keys.created < current_timestamp - $4 * interval '1 second'
+	or (idempotency_keys.status = 0 and idempotency_keys.created < current_timestamp - $5 * interval '1 second')
+	returning owner_id`
+	var claimed int64
+	err := s.db.QueryRow(ctx, sqlstmt, owner, key, hash,
+		int64(window/time.Second), int64(idempotencyLease/time.Second)).Scan(&claimed)
+	if err == nil {
+		return nil, nil
+	}
+	if err != pgx.ErrNoRows {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	stored := &types.StoredResponse{}
+	storedHash := ""
+	sqlstmt = `select request_hash, status, headers, coalesce(body, '') from idempotency_keys where owner_id = $1 and key = $2`
+	err = s.db.QueryRow(ctx, sqlstmt, owner, key).Scan(&storedHash, &stored.Status, &stored.Header, &stored.Body)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	if storedHash != hash {
+		return nil, types.ErrIdempotencyMismatch
+	}
+	if stored.Status == 0 {
+		return nil, types.ErrIdempotencyInProgress
+	}
+	return stored, nil
+}
+
+//SaveIdempotentResponse ... запоминает ответ на запрос с занятым ключом
+func (s *Service) SaveIdempotentResponse(ctx context.Context, owner int64, key string, response *types.StoredResponse) error {
+	sqlstmt := `update idempotency_keys set status = $3, headers = $4, body = $5 where owner_id = $1 and key = $2`
+	_, err := s.db.Exec(ctx, sqlstmt, owner, key, response.Status, response.Header, response.Body)
+	if err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//ReleaseIdempotencyKey ... освобождает ключ, если запрос не удался на стороне сервера, чтобы его можно было повторить
+func (s *Service) ReleaseIdempotencyKey(ctx context.Context, owner int64, key string) error {
+	_, err := s.db.Exec(ctx, `delete from idempotency_keys where owner_id = $1 and key = $2 and status = 0`, owner, key)
+	if err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	return nil
+}
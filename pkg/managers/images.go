@@ -0,0 +1,236 @@
+package managers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" //регистрируем декодер gif для image.Decode
+	"image/jpeg"
+	"image/png"
+	"log"
+	"strings"
+
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/FaranushKarimov/crud/pkg/utils"
+	"github.com/jackc/pgx/v4"
+)
+
+//MaxImageSize ... максимальный размер загружаемой картинки
+const MaxImageSize = 10 << 20
+
+const thumbnailSize = 256
+
+//Image ... картинка товара; у загруженных через UploadImage есть уменьшенная копия,
+//у внешних ссылок Thumbnail совпадает с URL
+type Image struct {
+	ID        int64  `json:"id"`
+	URL       string `json:"url"`
+	Thumbnail string `json:"thumbnail"`
+}
+
+//UploadImage ... кладет картинку и её уменьшенную копию в хранилище и добавляет её в конец списка картинок товара
+func (s *Service) UploadImage(ctx context.Context, productID int64, data []byte) (*Image, error) {
+	if _, err := s.ProductByID(ctx, productID); err != nil {
+		return nil, err
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, types.ErrInvalidImage
+	}
+
+	//png оставляем png (прозрачность), остальное уменьшаем в jpeg
+	thumb := &bytes.Buffer{}
+	thumbFormat := "jpeg"
+	if format == "png" {
+		thumbFormat = "png"
+		err = png.Encode(thumb, thumbnail(img, thumbnailSize))
+	} else {
+		err = jpeg.Encode(thumb, thumbnail(img, thumbnailSize), &jpeg.Options{Quality: 85})
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	name, err := utils.GenerateCode(16)
+	if err != nil {
+		return nil, err
+	}
+	name = strings.ToLower(name)
+	key := fmt.Sprintf("products/%d/%s.%s", productID, name, extension(format))
+	thumbKey := fmt.Sprintf("products/%d/%s_thumb.%s", productID, name, extension(thumbFormat))
+
+	if err = s.blobs.Put(ctx, key, "image/"+format, data); err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	if err = s.blobs.Put(ctx, thumbKey, "image/"+thumbFormat, thumb.Bytes()); err != nil {
+		log.Print(err)
+		s.deleteBlobs(ctx, key)
+		return nil, types.ErrInternal
+	}
+
+	item := &Image{URL: s.blobs.URL(key), Thumbnail: s.blobs.URL(thumbKey)}
+	sqlstmt := `
+	insert into products_images(product_id,url,thumbnail_url,blob_key,thumbnail_key,position)
+	values ($1,$2,$3,$4,$5,(select coalesce(max(position)+1,0) from products_images where product_id = $1))
+	returning id`
+	err = s.db.QueryRow(ctx, sqlstmt, productID, item.URL, item.Thumbnail, key, thumbKey).Scan(&item.ID)
+	if err == nil {
+		_, err = s.db.Exec(ctx, `update products set version = version + 1 where id = $1`, productID)
+	}
+	if err != nil {
+		log.Print(err)
+		s.deleteBlobs(ctx, key, thumbKey)
+		return nil, types.ErrInternal
+	}
+
+	return item, nil
+}
+
+//RemoveImage ...
+func (s *Service) RemoveImage(ctx context.Context, productID, imageID int64) error {
+	var key, thumbKey string
+	sqlstmt := `delete from products_images where id = $1 and product_id = $2 returning blob_key, thumbnail_key`
+	err := s.db.QueryRow(ctx, sqlstmt, imageID, productID).Scan(&key, &thumbKey)
+	if err == pgx.ErrNoRows {
+		return types.ErrNotFound
+	}
+	if err == nil {
+		_, err = s.db.Exec(ctx, `update products set version = version + 1 where id = $1`, productID)
+	}
+	if err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+
+	s.deleteBlobs(ctx, key, thumbKey)
+	return nil
+}
+
+//productsImages ... картинки товаров по порядку
+func (s *Service) productsImages(ctx context.Context, ids []int64) (map[int64][]*Image, error) {
+	images := make(map[int64][]*Image)
+
+	sqlstmt := `
+	select product_id, id, url, coalesce(nullif(thumbnail_url,''), url)
+	from products_images where product_id = any($1) order by product_id, position, id`
+	rows, err := s.db.Query(ctx, sqlstmt, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		item := &Image{}
+		if err = rows.Scan(&id, &item.ID, &item.URL, &item.Thumbnail); err != nil {
+			return nil, err
+		}
+		images[id] = append(images[id], item)
+	}
+
+	return images, rows.Err()
+}
+
+//saveImages ... оставляет у товара только переданные картинки (по URL) в переданном порядке,
+//возвращает ключи файлов удаленных картинок
+func saveImages(ctx context.Context, tx pgx.Tx, product *Product) ([]string, error) {
+	if product.Images == nil {
+		product.Images = make([]*Image, 0)
+	}
+	urls := make([]string, 0, len(product.Images))
+	for _, item := range product.Images {
+		urls = append(urls, item.URL)
+	}
+
+	removed := make([]string, 0)
+	rows, err := tx.Query(ctx, `delete from products_images where product_id = $1 and not (url = any($2))
+	returning blob_key, thumbnail_key`, product.ID, urls)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var key, thumbKey string
+		if err = rows.Scan(&key, &thumbKey); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		removed = append(removed, key, thumbKey)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	for i, item := range product.Images {
+		err = tx.QueryRow(ctx, `insert into products_images(product_id,url,position) values ($1,$2,$3)
+		on conflict (product_id,url) do update set position = excluded.position
+		returning id, coalesce(nullif(thumbnail_url,''), url)`, product.ID, item.URL, i).Scan(&item.ID, &item.Thumbnail)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return removed, nil
+}
+
+//deleteBlobs ... файлы удаляем после того как запись о них уже удалена, ошибки только логируем
+func (s *Service) deleteBlobs(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := s.blobs.Delete(ctx, key); err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+//thumbnail ... уменьшает картинку чтобы она влезла в max x max, каждый пиксел - среднее по своему прямоугольнику исходника
+func thumbnail(src image.Image, max int) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= max && h <= max {
+		return src
+	}
+
+	tw, th := max, max
+	if w > h {
+		th = h * max / w
+	} else {
+		tw = w * max / h
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	dst := image.NewRGBA64(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := bounds.Min.Y+y*h/th, bounds.Min.Y+(y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := bounds.Min.X+x*w/tw, bounds.Min.X+(x+1)*w/tw
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+func extension(format string) string {
+	if format == "jpeg" {
+		return "jpg"
+	}
+	return format
+}
@@ -0,0 +1,47 @@
+package managers
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestThumbnailFitsBox(t *testing.T) {
+	cases := []struct {
+		w, h, tw, th int
+	}{
+		{1000, 500, 256, 128},
+		{300, 1200, 64, 256},
+		{5000, 10, 256, 1},
+		{256, 256, 256, 256},
+		{100, 50, 100, 50},
+	}
+	for _, c := range cases {
+		src := image.NewRGBA(image.Rect(0, 0, c.w, c.h))
+		bounds := thumbnail(src, thumbnailSize).Bounds()
+		if bounds.Dx() != c.tw || bounds.Dy() != c.th {
+			t.Errorf("%dx%d -> %dx%d, want %dx%d", c.w, c.h, bounds.Dx(), bounds.Dy(), c.tw, c.th)
+		}
+	}
+}
+
+func TestThumbnailAveragesPixels(t *testing.T) {
+	//полосы черного и белого в 1 пиксел при уменьшении вдвое дают серый
+	src := image.NewGray(image.Rect(10, 10, 522, 522))
+	for y := 10; y < 522; y++ {
+		for x := 10; x < 522; x++ {
+			if x%2 == 0 {
+				src.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+
+	dst := thumbnail(src, thumbnailSize)
+	if b := dst.Bounds(); b.Dx() != 256 || b.Dy() != 256 {
+		t.Fatalf("bounds = %v, want 256x256", b)
+	}
+	r, g, b, a := dst.At(100, 100).RGBA()
+	if r != 0x7fff || g != 0x7fff || b != 0x7fff || a != 0xffff {
+		t.Errorf("pixel = %x %x %x %x, want mid gray", r, g, b, a)
+	}
+}
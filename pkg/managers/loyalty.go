@@ -0,0 +1,309 @@
+package managers
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/money"
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/jackc/pgx/v4"
+)
+
+//записи журнала баллов: начисление за продажу, списание в оплату, сгорание и отмена начисления;
+//баллы, вернувшиеся покупателю при возврате оплаченного ими товара, - тоже начисление (earn)
+//со ссылкой на оплату payment_id, у начисления за саму продажу payment_id пустой
+const (
+	LoyaltyEarn    = "earn"
+	LoyaltyRedeem  = "redeem"
+	LoyaltyExpire  = "expire"
+	LoyaltyReverse = "reverse"
+)
+
+//LoyaltyDefaultCategory ... ставка для категорий без своей ставки
+const LoyaltyDefaultCategory = "*"
+
+//LoyaltyConfig ... ExpiryDays - через сколько дней сгорают начисленные баллы,
+//SweepInterval - как часто фоновая задача списывает сгоревшие баллы в журнал
+type LoyaltyConfig struct {
+	ExpiryDays    int
+	SweepInterval time.Duration
+}
+
+//LoyaltyConfigFromEnv ... настройки из LOYALTY_EXPIRY_DAYS и LOYALTY_SWEEP_INTERVAL,
+//по умолчанию 365 дней и 1 час
+func LoyaltyConfigFromEnv() *LoyaltyConfig {
+	config := &LoyaltyConfig{ExpiryDays: 365, SweepInterval: time.Hour}
+	if value, err := strconv.Atoi(os.Getenv("LOYALTY_EXPIRY_DAYS")); err == nil && value > 0 {
+		config.ExpiryDays = value
+	}
+	if value, err := time.ParseDuration(os.Getenv("LOYALTY_SWEEP_INTERVAL")); err == nil && value > 0 {
+		config.SweepInterval = value
+	}
+	return config
+}
+
+//LoyaltyRate ... сколько баллов начисляется с суммы в базовой валюте, в сотых долях процента
+//(один балл - одна минимальная единица базовой валюты); Category "*" - ставка по умолчанию
+type LoyaltyRate struct {
+	Category string `json:"category"`
+	Rate     int    `json:"rate"`
+}
+
+//LoyaltyRates ...
+func (s *Service) LoyaltyRates(ctx context.Context) ([]*LoyaltyRate, error) {
+	items := make([]*LoyaltyRate, 0)
+
+	rows, err := s.db.Query(ctx, `select category, rate from loyalty_rates order by category`)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &LoyaltyRate{}
+		if err = rows.Scan(&item.Category, &item.Rate); err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+	return items, nil
+}
+
+//SetLoyaltyRate ... ставка 0 убирает ставку категории
+func (s *Service) SetLoyaltyRate(ctx context.Context, item *LoyaltyRate) (*LoyaltyRate, error) {
+	if item.Category == "" || item.Rate < 0 || item.Rate > rateBase {
+		return nil, types.ErrInvalidLoyaltyRate
+	}
+
+	var err error
+	if item.Rate == 0 {
+		_, err = s.db.Exec(ctx, `delete from loyalty_rates where category = $1`, item.Category)
+	} else {
+		_, err = s.db.Exec(ctx, `insert into loyalty_rates(category,rate) values ($1,$2)
+		on conflict (category) do update set rate = excluded.rate`, item.Category, item.Rate)
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
+
+//earnPoints ... начисляет баллы за подтвержденную продажу по ставкам категорий товаров с суммы
+//без налога после всех скидок; баллы получает только зарегистрированный активный покупатель
+func (s *Service) earnPoints(ctx context.Context, tx pgx.Tx, sale *Sale) error {
+	sqlstmt := `
+	select sp.net, coalesce(lr.rate, ld.rate, 0)
+	from sales_positions sp
+	join products p on p.id = sp.product_id
+	left join loyalty_rates lr on lr.category = p.category
+	left join loyalty_rates ld on ld.category = $2
+	where sp.sale_id = $1`
+	rows, err := tx.Query(ctx, sqlstmt, sale.ID, LoyaltyDefaultCategory)
+	if err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	defer rows.Close()
+
+	points := 0
+	for rows.Next() {
+		var net, rate int
+		if err = rows.Scan(&net, &rate); err != nil {
+			log.Print(err)
+			return types.ErrInternal
+		}
+		points += divRound(money.ToBase(money.New(net, sale.Currency), sale.Rate)*rate, rateBase)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return types.ErrInternal
+	}
+	if points <= 0 {
+		return nil
+	}
+
+	sqlstmt = `
+	insert into loyalty_ledger (customer_id, sale_id, kind, points, remaining, expires)
+	select c.id, $2, $3, $4, $4, localtimestamp + $5 * interval '1 day'
+	from customers c where c.id = $1 and c.active`
+	_, err = tx.Exec(ctx, sqlstmt, sale.CustomerID, sale.ID, LoyaltyEarn, points, s.loyalty.ExpiryDays)
+	if err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//reversePoints ... при отмене продажи снимает еще не потраченные баллы, начисленные за неё
+func reversePoints(ctx context.Context, tx pgx.Tx, saleID int64) error {
+	sqlstmt := `
+	with earned as (
+		select id, customer_id, remaining from loyalty_ledger
+		where sale_id = $1 and kind = $2 and payment_id is null and remaining > 0 for update
+	), cleared as (
+		update loyalty_ledger l set remaining = 0 from earned e where l.id = e.id
+	)
+	insert into loyalty_ledger (customer_id, sale_id, kind, points)
+	select customer_id, $1, $3, -remaining from earned`
+	if _, err := tx.Exec(ctx, sqlstmt, saleID, LoyaltyEarn, LoyaltyReverse); err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//returnPoints ... при возврате снимает баллы за возвращенный товар по тем же ставкам категорий,
+//что и при начислении; снять можно только еще не потраченный остаток начисления за продажу
+func returnPoints(ctx context.Context, tx pgx.Tx, ret *Return, rate float64) error {
+	sqlstmt := `
+	select coalesce(lr.rate, ld.rate, 0)
+	from sales_positions sp
+	join products p on p.id = sp.product_id
+	left join loyalty_rates lr on lr.category = p.category
+	left join loyalty_rates ld on ld.category = $2
+	where sp.id = $1`
+
+	points := 0
+	for _, position := range ret.Positions {
+		earnRate := 0
+		if err := tx.QueryRow(ctx, sqlstmt, position.PositionID, LoyaltyDefaultCategory).Scan(&earnRate); err != nil {
+			log.Print(err)
+			return types.ErrInternal
+		}
+		points += divRound(money.ToBase(money.New(position.Net, ret.Currency), rate)*earnRate, rateBase)
+	}
+	if points <= 0 {
+		return nil
+	}
+
+	sqlstmt = `
+	with earned as (
+		select id, customer_id, least(remaining, $4) as taken from loyalty_ledger
+		where sale_id = $1 and kind = $2 and payment_id is null and remaining > 0 order by id limit 1 for update
+	), cleared as (
+		update loyalty_ledger l set remaining = l.remaining - e.taken from earned e where l.id = e.id
+	)
+	insert into loyalty_ledger (customer_id, sale_id, kind, points)
+	select customer_id, $1, $3, -taken from earned`
+	if _, err := tx.Exec(ctx, sqlstmt, ret.SaleID, LoyaltyEarn, LoyaltyReverse, points); err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//refundPoints ... возвращает покупателю points баллов, которыми была оплачена продажа (оплата paymentID),
+//они сгорают так же, как начисленные
+func (s *Service) refundPoints(ctx context.Context, tx pgx.Tx, customerID, saleID, paymentID int64, points int) error {
+	sqlstmt := `
+	insert into loyalty_ledger (customer_id, sale_id, payment_id, kind, points, remaining, expires)
+	values ($1, $2, $3, $4, $5, $5, localtimestamp + $6 * interval '1 day')`
+	_, err := tx.Exec(ctx, sqlstmt, customerID, saleID, paymentID, LoyaltyEarn, points, s.loyalty.ExpiryDays)
+	if err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//redeemPoints ... списывает points баллов в оплату payment, первыми тратятся те, что сгорят раньше
+func redeemPoints(ctx context.Context, tx pgx.Tx, customerID int64, payment *Payment, points int) error {
+	sqlstmt := `
+	select id, remaining from loyalty_ledger
+	where customer_id = $1 and kind = $2 and remaining > 0 and expires > current_timestamp
+	order by expires, id for update`
+	rows, err := tx.Query(ctx, sqlstmt, customerID, LoyaltyEarn)
+	if err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	defer rows.Close()
+
+	spend := make(map[int64]int)
+	ids := make([]int64, 0)
+	left := points
+	for rows.Next() && left > 0 {
+		var id int64
+		var remaining int
+		if err = rows.Scan(&id, &remaining); err != nil {
+			log.Print(err)
+			return types.ErrInternal
+		}
+		if remaining > left {
+			remaining = left
+		}
+		spend[id] = remaining
+		ids = append(ids, id)
+		left -= remaining
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return types.ErrInternal
+	}
+	if left > 0 {
+		return types.ErrInsufficientPoints
+	}
+
+	for _, id := range ids {
+		if _, err = tx.Exec(ctx, `update loyalty_ledger set remaining = remaining - $2 where id = $1`, id, spend[id]); err != nil {
+			log.Print(err)
+			return types.ErrInternal
+		}
+	}
+	_, err = tx.Exec(ctx, `insert into loyalty_ledger (customer_id, sale_id, payment_id, kind, points) values ($1, $2, $3, $4, $5)`,
+		customerID, payment.SaleID, payment.ID, LoyaltyRedeem, -points)
+	if err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//ExpirePoints ... записывает в журнал сгоревшие остатки начислений и возвращает количество таких начислений
+func (s *Service) ExpirePoints(ctx context.Context) (int64, error) {
+	sqlstmt := `
+	with expired as (
+		select id, customer_id, remaining from loyalty_ledger
+		where kind = $1 and remaining > 0 and expires <= current_timestamp for update
+	), cleared as (
+		update loyalty_ledger l set remaining = 0 from expired e where l.id = e.id
+	)
+	insert into loyalty_ledger (customer_id, kind, points)
+	select customer_id, $2, -remaining from expired`
+	tag, err := s.db.Exec(ctx, sqlstmt, LoyaltyEarn, LoyaltyExpire)
+	if err != nil {
+		log.Print(err)
+		return 0, types.ErrInternal
+	}
+	return tag.RowsAffected(), nil
+}
+
+//RunLoyaltyExpiry ... фоновая задача: раз в SweepInterval списывает сгоревшие баллы, пока жив ctx
+func (s *Service) RunLoyaltyExpiry(ctx context.Context) {
+	ticker := time.NewTicker(s.loyalty.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			count, err := s.ExpirePoints(ctx)
+			if err == nil && count > 0 {
+				log.Printf("expired loyalty points of %d accruals", count)
+			}
+		}
+	}
+}
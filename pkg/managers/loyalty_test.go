@@ -0,0 +1,116 @@
+package managers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMakeReturnReversesPoints(t *testing.T) {
+	s := testService(t)
+	ctx := context.Background()
+
+	managerID := testManager(t, s)
+	customerID := testCustomer(t, s)
+	productID := testProduct(t, s, 1000, 5)
+	category := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	if _, err := s.db.Exec(ctx, `update products set category = $2 where id = $1`, productID, category); err != nil {
+		t.Fatalf("update product: %v", err)
+	}
+	if _, err := s.SetLoyaltyRate(ctx, &LoyaltyRate{Category: category, Rate: 1000}); err != nil {
+		t.Fatalf("SetLoyaltyRate: %v", err)
+	}
+
+	sale, err := s.MakeSale(ctx, &Sale{
+		ManagerID:  managerID,
+		CustomerID: customerID,
+		Positions:  []*SalePosition{{ProductID: productID, Qty: 2}},
+	})
+	if err != nil {
+		t.Fatalf("MakeSale: %v", err)
+	}
+	if got := customerPoints(t, s, customerID); got != 200 {
+		t.Fatalf("earned = %d, want 200", got)
+	}
+
+	_, err = s.MakeReturn(ctx, &Return{
+		SaleID:    sale.ID,
+		ManagerID: managerID,
+		Positions: []*ReturnPosition{{PositionID: sale.Positions[0].ID, Qty: 1}},
+	})
+	if err != nil {
+		t.Fatalf("MakeReturn: %v", err)
+	}
+	if got := customerPoints(t, s, customerID); got != 100 {
+		t.Errorf("points after return = %d, want 100", got)
+	}
+}
+
+func customerPoints(t *testing.T, s *Service, customerID int64) int {
+	t.Helper()
+	points := 0
+	err := s.db.QueryRow(context.Background(),
+		`select coalesce(sum(remaining),0) from loyalty_ledger where customer_id = $1 and kind = $2`, customerID, LoyaltyEarn).Scan(&points)
+	if err != nil {
+		t.Fatalf("select points: %v", err)
+	}
+	return points
+}
+
+func TestMakeReturnRefundsLoyaltyShareAsPoints(t *testing.T) {
+	s := testService(t)
+	ctx := context.Background()
+
+	managerID := testManager(t, s)
+	customerID := testCustomer(t, s)
+	productID := testProduct(t, s, 100, 5)
+	_, err := s.db.Exec(ctx, `insert into loyalty_ledger (customer_id, kind, points, remaining, expires)
+		values ($1, $2, 300, 300, localtimestamp + interval '30 days')`, customerID, LoyaltyEarn)
+	if err != nil {
+		t.Fatalf("insert points: %v", err)
+	}
+
+	sale, err := s.MakeSale(ctx, &Sale{
+		ManagerID:  managerID,
+		CustomerID: customerID,
+		Positions:  []*SalePosition{{ProductID: productID, Qty: 2}},
+	})
+	if err != nil {
+		t.Fatalf("MakeSale: %v", err)
+	}
+	_, err = s.AddPayments(ctx, sale.ID, managerID, []*Payment{
+		{Method: PaymentLoyalty, Amount: 100},
+		{Method: PaymentCard, Amount: 100},
+	})
+	if err != nil {
+		t.Fatalf("AddPayments: %v", err)
+	}
+	if got := customerPoints(t, s, customerID); got != 200 {
+		t.Fatalf("points after payment = %d, want 200", got)
+	}
+
+	ret, err := s.MakeReturn(ctx, &Return{
+		SaleID:      sale.ID,
+		ManagerID:   managerID,
+		StoreCredit: true,
+		Positions:   []*ReturnPosition{{PositionID: sale.Positions[0].ID, Qty: 1}},
+	})
+	if err != nil {
+		t.Fatalf("MakeReturn: %v", err)
+	}
+	if ret.Refund != 100 || ret.Loyalty != 50 {
+		t.Errorf("Refund, Loyalty = %d, %d, want 100, 50", ret.Refund, ret.Loyalty)
+	}
+	if got := customerPoints(t, s, customerID); got != 250 {
+		t.Errorf("points after return = %d, want 250", got)
+	}
+
+	credit := 0
+	if err = s.db.QueryRow(ctx, `select credit from customers where id = $1`, customerID).Scan(&credit); err != nil {
+		t.Fatalf("select credit: %v", err)
+	}
+	if credit != 50 {
+		t.Errorf("credit = %d, want 50 paid with money", credit)
+	}
+}
@@ -0,0 +1,188 @@
+package managers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/money"
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/jackc/pgx/v4"
+)
+
+//способы оплаты; store_credit списывается с баланса покупателя (customers.credit, в базовой валюте) по курсу продажи,
+//loyalty - баллами программы лояльности по курсу продажи (балл - минимальная единица базовой валюты)
+const (
+	PaymentCash        = "cash"
+	PaymentCard        = "card"
+	PaymentTransfer    = "transfer"
+	PaymentStoreCredit = "store_credit"
+	PaymentLoyalty     = "loyalty"
+)
+
+//Payment ... оплата продажи в её валюте; Amount - сколько зачтено в оплату,
+//для наличных Tendered - сколько дал покупатель, Change - сдача
+type Payment struct {
+	ID        int64     `json:"id"`
+	SaleID    int64     `json:"sale_id"`
+	ManagerID int64     `json:"manager_id"`
+	Method    string    `json:"method"`
+	Amount    int       `json:"amount"`
+	Tendered  int       `json:"tendered"`
+	Change    int       `json:"change"`
+	Created   time.Time `json:"created"`
+}
+
+//AddPayments ... принимает одну или несколько оплат (раздельная оплата) по подтвержденной продаже;
+//безналичные оплаты зачитываются первыми и не могут превышать остаток, наличные - последними,
+//излишек по ним возвращается сдачей; когда остаток становится нулевым, продажа переходит в paid
+func (s *Service) AddPayments(ctx context.Context, saleID, managerID int64, payments []*Payment) (*Sale, error) {
+	if len(payments) == 0 {
+		return nil, types.ErrInvalidPayment
+	}
+	ordered := make([]*Payment, 0, len(payments))
+	cash := make([]*Payment, 0)
+	for _, payment := range payments {
+		switch payment.Method {
+		case PaymentCard, PaymentTransfer, PaymentStoreCredit, PaymentLoyalty:
+			ordered = append(ordered, payment)
+		case PaymentCash:
+			cash = append(cash, payment)
+		default:
+			return nil, types.ErrInvalidPayment
+		}
+		if payment.Amount <= 0 {
+			return nil, types.ErrInvalidPayment
+		}
+	}
+	ordered = append(ordered, cash...)
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	var customerID int64
+	var status, currency string
+	var rate float64
+	err = tx.QueryRow(ctx, `select coalesce(customer_id,0), status, currency, rate from sales where id = $1 for update`, saleID).
+		Scan(&customerID, &status, &currency, &rate)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	if status != SaleConfirmed {
+		return nil, types.ErrSaleStatus
+	}
+	balance, err := saleBalance(ctx, tx, saleID)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	for _, payment := range ordered {
+		if balance == 0 {
+			return nil, types.ErrOverpayment
+		}
+		payment.SaleID, payment.ManagerID = saleID, managerID
+		payment.Tendered, payment.Change = 0, 0
+		if payment.Method == PaymentCash {
+			payment.Tendered = payment.Amount
+			if payment.Amount > balance {
+				payment.Change = payment.Amount - balance
+				payment.Amount = balance
+			}
+		}
+		if payment.Amount > balance {
+			return nil, types.ErrOverpayment
+		}
+
+		if payment.Method == PaymentStoreCredit {
+			credit := money.ToBase(money.New(payment.Amount, currency), rate)
+			if credit <= 0 {
+				return nil, types.ErrInvalidPayment
+			}
+			tag, err := tx.Exec(ctx, `update customers set credit = credit - $1 where id = $2 and credit >= $1`, credit, customerID)
+			if err != nil {
+				log.Print(err)
+				return nil, types.ErrInternal
+			}
+			if tag.RowsAffected() != 1 {
+				return nil, types.ErrInsufficientCredit
+			}
+		}
+
+		sqlstmt := `insert into payments (sale_id,manager_id,method,amount,tendered,change) values ($1,$2,$3,$4,$5,$6) returning id, created`
+		err = tx.QueryRow(ctx, sqlstmt, payment.SaleID, payment.ManagerID, payment.Method, payment.Amount, payment.Tendered, payment.Change).
+			Scan(&payment.ID, &payment.Created)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		if payment.Method == PaymentLoyalty {
+			points := money.ToBase(money.New(payment.Amount, currency), rate)
+			if points <= 0 {
+				return nil, types.ErrInvalidPayment
+			}
+			if err = redeemPoints(ctx, tx, customerID, payment, points); err != nil {
+				return nil, err
+			}
+		}
+		balance -= payment.Amount
+	}
+
+	if balance == 0 {
+		_, err = tx.Exec(ctx, `update sales set status = $2, paid = current_timestamp where id = $1`, saleID, SalePaid)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	return s.SaleByID(ctx, saleID)
+}
+
+//saleBalance ... остаток к оплате по продаже: возвращенный товар оплачивать не нужно,
+//а выданное по возвратам уже не считается оплатой
+func saleBalance(ctx context.Context, q querier, saleID int64) (balance int, err error) {
+	sqlstmt := `
+	select coalesce((select sum(sp.net + sp.tax) from sales_positions sp where sp.sale_id = $1),0) -
+	coalesce((select sum(rp.net + rp.tax) from returns_positions rp join returns r on r.id = rp.return_id where r.sale_id = $1),0) -
+	coalesce((select sum(pm.amount) from payments pm where pm.sale_id = $1),0) +
+	coalesce((select sum(r.refund) from returns r where r.sale_id = $1),0)`
+	err = q.QueryRow(ctx, sqlstmt, saleID).Scan(&balance)
+	return balance, err
+}
+
+//salePayments ... оплаты продажи по порядку
+func salePayments(ctx context.Context, q querier, saleID int64) ([]*Payment, error) {
+	items := make([]*Payment, 0)
+
+	sqlstmt := `select id, sale_id, manager_id, method, amount, tendered, change, created from payments where sale_id = $1 order by id`
+	rows, err := q.Query(ctx, sqlstmt, saleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Payment{}
+		err = rows.Scan(&item.ID, &item.SaleID, &item.ManagerID, &item.Method, &item.Amount, &item.Tendered, &item.Change, &item.Created)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
@@ -0,0 +1,244 @@
+package managers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/jackc/pgx/v4"
+)
+
+//статусы расчета зарплаты: черновик пересчитывается, закрытый больше не меняется
+const (
+	PayrollDraft  = "draft"
+	PayrollLocked = "locked"
+)
+
+//PayrollRun ... расчет зарплаты за месяц Period (формат 2006-01), суммы в базовой валюте
+type PayrollRun struct {
+	ID       int64          `json:"id"`
+	Period   string         `json:"period"`
+	Status   string         `json:"status"`
+	Total    int            `json:"total"`
+	Created  time.Time      `json:"created"`
+	Computed time.Time      `json:"computed"`
+	Locked   *time.Time     `json:"locked"`
+	LockedBy int64          `json:"locked_by"`
+	Lines    []*PayrollLine `json:"lines"`
+}
+
+//PayrollLine ... начисление менеджеру: оклад плюс комиссия от выручки Revenue по схеме SchemeID
+type PayrollLine struct {
+	ManagerID  int64  `json:"manager_id"`
+	Name       string `json:"name"`
+	SchemeID   int64  `json:"scheme_id"`
+	Plan       int    `json:"plan"`
+	Revenue    int    `json:"revenue"`
+	Salary     int    `json:"salary"`
+	Commission int    `json:"commission"`
+	Total      int    `json:"total"`
+}
+
+//RunPayroll ... считает (или пересчитывает, пока не закрыт) зарплату за месяц period
+func (s *Service) RunPayroll(ctx context.Context, period string) (*PayrollRun, error) {
+	from, err := time.ParseInLocation("2006-01", period, time.Local)
+	if err != nil {
+		return nil, types.ErrInvalidPeriod
+	}
+	to := from.AddDate(0, 1, 0)
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	run := &PayrollRun{Lines: make([]*PayrollLine, 0)}
+	_, err = tx.Exec(ctx, `insert into payroll_runs (period) values ($1) on conflict (period) do nothing`, from)
+	if err == nil {
+		err = tx.QueryRow(ctx, `select id, status from payroll_runs where period = $1 for update`, from).Scan(&run.ID, &run.Status)
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	if run.Status == PayrollLocked {
+		return nil, types.ErrPayrollLocked
+	}
+
+	revenue, err := netRevenue(ctx, tx, from, to)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	sqlstmt := `
+	select m.id, m.name, m.salary, m.active,
+	coalesce((select mp.amount from managers_plans mp where mp.manager_id = m.id and mp.period = $1 order by mp.id desc limit 1), 0),
+	coalesce(cs.id, 0), coalesce(cs.kind, ''), coalesce(cs.rate, 0), coalesce(cs.tiers, '[]'), coalesce(cs.categories, '{}')
+	from managers m
+	left join commission_schemes cs on cs.id = m.commission_scheme_id and cs.active
+	order by m.id`
+	rows, err := tx.Query(ctx, sqlstmt, from)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		line := &PayrollLine{}
+		scheme := &CommissionScheme{}
+		active := false
+		err = rows.Scan(&line.ManagerID, &line.Name, &line.Salary, &active, &line.Plan,
+			&scheme.ID, &scheme.Kind, &scheme.Rate, &scheme.Tiers, &scheme.Categories)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		sales := revenue[line.ManagerID]
+		//уволенные попадают в расчет только если у них были продажи в этом месяце
+		if !active && len(sales) == 0 {
+			continue
+		}
+
+		for _, amount := range sales {
+			line.Revenue += amount
+		}
+		line.SchemeID = scheme.ID
+		if scheme.ID != 0 {
+			line.Commission = scheme.Commission(sales, line.Plan)
+		}
+		line.Total = line.Salary + line.Commission
+		run.Total += line.Total
+		run.Lines = append(run.Lines, line)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+
+	if _, err = tx.Exec(ctx, `delete from payroll_lines where run_id = $1`, run.ID); err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	for _, line := range run.Lines {
+		sqlstmt = `insert into payroll_lines (run_id,manager_id,scheme_id,plan,revenue,salary,commission,total)
+		values ($1,$2,nullif($3,0),$4,$5,$6,$7,$8)`
+		_, err = tx.Exec(ctx, sqlstmt, run.ID, line.ManagerID, line.SchemeID, line.Plan, line.Revenue, line.Salary, line.Commission, line.Total)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+	}
+	_, err = tx.Exec(ctx, `update payroll_runs set total = $2, computed = current_timestamp where id = $1`, run.ID, run.Total)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	return s.PayrollRun(ctx, run.ID)
+}
+
+//LockPayroll ... закрывает расчет, после этого его нельзя пересчитать
+func (s *Service) LockPayroll(ctx context.Context, id, managerID int64) (*PayrollRun, error) {
+	sqlstmt := `update payroll_runs set status = $2, locked = current_timestamp, locked_by = $3 where id = $1 and status = $4`
+	tag, err := s.db.Exec(ctx, sqlstmt, id, PayrollLocked, managerID, PayrollDraft)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	if tag.RowsAffected() == 0 {
+		if _, err = s.PayrollRun(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, types.ErrPayrollLocked
+	}
+	return s.PayrollRun(ctx, id)
+}
+
+//PayrollRuns ... расчеты без строк, новые сверху
+func (s *Service) PayrollRuns(ctx context.Context) ([]*PayrollRun, error) {
+	items := make([]*PayrollRun, 0)
+
+	rows, err := s.db.Query(ctx, `select `+payrollRunColumns+` from payroll_runs order by period desc`)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanPayrollRun(rows)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+
+	return items, nil
+}
+
+//PayrollRun ... расчет со строками по менеджерам
+func (s *Service) PayrollRun(ctx context.Context, id int64) (*PayrollRun, error) {
+	run, err := scanPayrollRun(s.db.QueryRow(ctx, `select `+payrollRunColumns+` from payroll_runs where id = $1`, id))
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	sqlstmt := `
+	select pl.manager_id, m.name, coalesce(pl.scheme_id, 0), pl.plan, pl.revenue, pl.salary, pl.commission, pl.total
+	from payroll_lines pl
+	join managers m on m.id = pl.manager_id
+	where pl.run_id = $1
+	order by pl.manager_id`
+	rows, err := s.db.Query(ctx, sqlstmt, id)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		line := &PayrollLine{}
+		err = rows.Scan(&line.ManagerID, &line.Name, &line.SchemeID, &line.Plan, &line.Revenue, &line.Salary, &line.Commission, &line.Total)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		run.Lines = append(run.Lines, line)
+	}
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+
+	return run, nil
+}
+
+const payrollRunColumns = `id, to_char(period, 'YYYY-MM'), status, total, created, computed, locked, coalesce(locked_by, 0)`
+
+func scanPayrollRun(row pgx.Row) (*PayrollRun, error) {
+	item := &PayrollRun{Lines: make([]*PayrollLine, 0)}
+	err := row.Scan(&item.ID, &item.Period, &item.Status, &item.Total, &item.Created, &item.Computed, &item.Locked, &item.LockedBy)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
@@ -0,0 +1,242 @@
+package managers
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/jackc/pgx/v4"
+)
+
+//Plan ... план менеджера на месяц Period (формат 2006-01) в минимальных единицах базовой валюты;
+//план ставится на выручку без налога за вычетом возвратов (та же база, что у комиссий, см. netRevenue);
+//планы не перезаписываются, действует последний заданный на этот месяц
+type Plan struct {
+	ID        int64     `json:"id"`
+	ManagerID int64     `json:"manager_id"`
+	Period    string    `json:"period"`
+	Amount    int       `json:"amount"`
+	CreatedBy int64     `json:"created_by"`
+	Created   time.Time `json:"created"`
+}
+
+//PlanProgress ... выполнение плана: Percent - процент выполнения, Forecast - прогноз выручки
+//на конец месяца по текущему темпу продаж
+type PlanProgress struct {
+	ManagerID    int64   `json:"manager_id,omitempty"`
+	Name         string  `json:"name"`
+	DepartmentID int64   `json:"department_id,omitempty"`
+	Department   string  `json:"department,omitempty"`
+	Plan         int     `json:"plan"`
+	Actual       int     `json:"actual"`
+	Percent      float64 `json:"percent"`
+	Forecast     int     `json:"forecast"`
+}
+
+//PlansReport ... выполнение планов за месяц по менеджерам, по командам (отделам) и в целом;
+//план команды - план отдела на месяц, а если он не задан - сумма планов её менеджеров;
+//в отчет попадают и отделы с планом без продаж, общий план - сумма планов команд
+type PlansReport struct {
+	Period   string          `json:"period"`
+	Managers []*PlanProgress `json:"managers"`
+	Teams    []*PlanProgress `json:"teams"`
+	Total    *PlanProgress   `json:"total"`
+}
+
+//SavePlan ... задает план менеджера на месяц, прежние значения остаются в истории
+func (s *Service) SavePlan(ctx context.Context, plan *Plan) (*Plan, error) {
+	period, err := time.ParseInLocation("2006-01", plan.Period, time.Local)
+	if err != nil || plan.Amount < 0 || plan.ManagerID == 0 {
+		return nil, types.ErrInvalidPlan
+	}
+
+	sqlstmt := `
+	insert into managers_plans (manager_id, period, amount, created_by)
+	select id, $2, $3, $4 from managers where id = $1
+	returning id, created`
+	err = s.db.QueryRow(ctx, sqlstmt, plan.ManagerID, period, plan.Amount, plan.CreatedBy).Scan(&plan.ID, &plan.Created)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	return plan, nil
+}
+
+//Plans ... история планов менеджера, новые сверху
+func (s *Service) Plans(ctx context.Context, managerID int64) ([]*Plan, error) {
+	items := make([]*Plan, 0)
+
+	sqlstmt := `
+	select id, manager_id, to_char(period, 'YYYY-MM'), amount, coalesce(created_by, 0), created
+	from managers_plans
+	where manager_id = $1
+	order by period desc, id desc`
+	rows, err := s.db.Query(ctx, sqlstmt, managerID)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Plan{}
+		err = rows.Scan(&item.ID, &item.ManagerID, &item.Period, &item.Amount, &item.CreatedBy, &item.Created)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+
+	return items, nil
+}
+
+//PlansProgress ... выполнение планов за месяц period (формат 2006-01) на момент now
+func (s *Service) PlansProgress(ctx context.Context, period string, now time.Time) (*PlansReport, error) {
+	from, err := time.ParseInLocation("2006-01", period, time.Local)
+	if err != nil {
+		return nil, types.ErrInvalidPlan
+	}
+	to := from.AddDate(0, 1, 0)
+
+	report := &PlansReport{Period: period, Managers: make([]*PlanProgress, 0), Teams: make([]*PlanProgress, 0), Total: &PlanProgress{}}
+	byManager := make(map[int64]*PlanProgress)
+
+	//план каждого менеджера на месяц (последнее значение), без плана и продаж в отчет не попадают
+	sqlstmt := `
+	select m.id, m.name, coalesce(m.department_id, 0), coalesce(d.name, ''),
+	coalesce((select mp.amount from managers_plans mp where mp.manager_id = m.id and mp.period = $1 order by mp.id desc limit 1), 0)
+	from managers m
+	left join departments d on d.id = m.department_id`
+	rows, err := s.db.Query(ctx, sqlstmt, from)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &PlanProgress{}
+		if err = rows.Scan(&item.ManagerID, &item.Name, &item.DepartmentID, &item.Department, &item.Plan); err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		byManager[item.ManagerID] = item
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+
+	//команды - отделы со своим планом на месяц (последнее значение), менеджеры без отдела - команда с ID 0
+	byTeam := map[int64]*PlanProgress{0: {}}
+	teamPlans := make(map[int64]int)
+	sqlstmt = `
+	select d.id, d.name,
+	(select dp.amount from departments_plans dp where dp.department_id = d.id and dp.period = $1 order by dp.id desc limit 1)
+	from departments d`
+	rows, err = s.db.Query(ctx, sqlstmt, from)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		team := &PlanProgress{}
+		var plan *int
+		if err = rows.Scan(&team.DepartmentID, &team.Name, &plan); err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		team.Department = team.Name
+		byTeam[team.DepartmentID] = team
+		if plan != nil {
+			teamPlans[team.DepartmentID] = *plan
+		}
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+
+	revenue, err := netRevenue(ctx, s.db, from, to)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	for id, byCategory := range revenue {
+		if item, ok := byManager[id]; ok {
+			item.Actual = revenueTotal(byCategory)
+		}
+	}
+
+	for _, item := range byManager {
+		if item.Plan == 0 && item.Actual == 0 {
+			continue
+		}
+		report.Managers = append(report.Managers, item)
+
+		team, ok := byTeam[item.DepartmentID]
+		if !ok {
+			team = &PlanProgress{Name: item.Department, DepartmentID: item.DepartmentID, Department: item.Department}
+			byTeam[item.DepartmentID] = team
+		}
+		team.Plan += item.Plan
+		team.Actual += item.Actual
+	}
+	//план отдела заменяет сумму планов его менеджеров; итог - по командам, чтобы совпадал с ними
+	for id, team := range byTeam {
+		if plan, ok := teamPlans[id]; ok {
+			team.Plan = plan
+		}
+		if team.Plan == 0 && team.Actual == 0 {
+			continue
+		}
+		report.Teams = append(report.Teams, team)
+		report.Total.Plan += team.Plan
+		report.Total.Actual += team.Actual
+	}
+
+	for _, items := range [][]*PlanProgress{report.Managers, report.Teams, {report.Total}} {
+		for _, item := range items {
+			item.Percent = percentOf(item.Actual, item.Plan)
+			item.Forecast = forecast(item.Actual, from, to, now)
+		}
+	}
+	sort.Slice(report.Managers, func(i, j int) bool { return report.Managers[i].Percent > report.Managers[j].Percent })
+	sort.Slice(report.Teams, func(i, j int) bool { return report.Teams[i].Percent > report.Teams[j].Percent })
+
+	return report, nil
+}
+
+//percentOf ... процент выполнения с точностью до сотых, без плана - 0
+func percentOf(actual, plan int) float64 {
+	if plan <= 0 {
+		return 0
+	}
+	return math.Round(float64(actual)*10000/float64(plan)) / 100
+}
+
+//forecast ... выручка на конец периода [from, to) при сохранении темпа продаж с начала периода до now
+func forecast(actual int, from, to, now time.Time) int {
+	if !now.After(from) {
+		return 0
+	}
+	if !now.Before(to) {
+		return actual
+	}
+	return int(math.Round(float64(actual) * float64(to.Sub(from)) / float64(now.Sub(from))))
+}
@@ -0,0 +1,45 @@
+package managers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPlansProgressDepartmentWithoutManagers(t *testing.T) {
+	s := testService(t)
+	ctx := context.Background()
+
+	var departmentID int64
+	err := s.db.QueryRow(ctx, `insert into departments (name) values ($1) returning id`,
+		fmt.Sprintf("test-%d", time.Now().UnixNano())).Scan(&departmentID)
+	if err != nil {
+		t.Fatalf("insert department: %v", err)
+	}
+	if _, err = s.SaveDepartmentPlan(ctx, &DepartmentPlan{DepartmentID: departmentID, Period: "2099-01", Amount: 1000}); err != nil {
+		t.Fatalf("SaveDepartmentPlan: %v", err)
+	}
+
+	report, err := s.PlansProgress(ctx, "2099-01", time.Now())
+	if err != nil {
+		t.Fatalf("PlansProgress: %v", err)
+	}
+
+	found, plan := false, 0
+	for _, team := range report.Teams {
+		plan += team.Plan
+		if team.DepartmentID == departmentID {
+			found = true
+			if team.Plan != 1000 || team.Actual != 0 {
+				t.Errorf("team plan = %d, actual = %d, want 1000 and 0", team.Plan, team.Actual)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("department %d with a plan is missing from teams", departmentID)
+	}
+	if report.Total.Plan != plan {
+		t.Errorf("Total.Plan = %d, want sum of team plans %d", report.Total.Plan, plan)
+	}
+}
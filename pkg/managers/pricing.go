@@ -0,0 +1,75 @@
+package managers
+
+import (
+	"context"
+	"log"
+
+	"github.com/FaranushKarimov/crud/pkg/money"
+	"github.com/FaranushKarimov/crud/pkg/types"
+)
+
+//checkOverrides ... ручная цена допустима только с причиной и только у менеджера с правом менять цены
+func (s *Service) checkOverrides(ctx context.Context, sale *Sale) error {
+	overrides := false
+	for _, position := range sale.Positions {
+		if position.OverridePrice == nil {
+			continue
+		}
+		if position.OverrideReason == "" {
+			return types.ErrOverrideReason
+		}
+		if position.OverridePrice.Amount < 0 {
+			return types.ErrInvalidPosition
+		}
+		if position.OverridePrice.Currency == "" {
+			position.OverridePrice.Currency = sale.Currency
+		}
+		if position.OverridePrice.Currency != sale.Currency {
+			return types.ErrCurrencyMismatch
+		}
+		overrides = true
+	}
+	if !overrides {
+		return nil
+	}
+
+	allowed := false
+	err := s.db.QueryRow(ctx, `select is_admin or price_override from managers where id = $1`, sale.ManagerID).Scan(&allowed)
+	if err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	if !allowed {
+		return types.ErrOverrideForbidden
+	}
+	return nil
+}
+
+//resolvePrice ... цена позиции берется из товара в валюте продажи: явная цена в этой валюте,
+//иначе базовая по курсу продажи; ручная цена только заменяет итоговую, каталожная остается в ListPrice
+func resolvePrice(ctx context.Context, q querier, position *SalePosition, currency string, rate float64) error {
+	var base int
+	var price *int
+	sqlstmt := `
+	select p.price, pp.price
+	from products p
+	left join products_prices pp on pp.product_id = p.id and pp.currency = $2
+	where p.id = $1`
+	if err := q.QueryRow(ctx, sqlstmt, position.ProductID, currency).Scan(&base, &price); err != nil {
+		return err
+	}
+
+	if price != nil {
+		position.ListPrice = money.New(*price, currency)
+	} else {
+		position.ListPrice = money.FromBase(base, currency, rate)
+	}
+
+	position.Price = position.ListPrice
+	if position.OverridePrice != nil {
+		position.Price = *position.OverridePrice
+	} else {
+		position.OverrideReason = ""
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package managers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/money"
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	//PromotionPercent ... скидка value процентов от суммы позиции
+	PromotionPercent = "percent"
+	//PromotionFixed ... скидка value с каждой единицы товара
+	PromotionFixed = "fixed"
+	//PromotionBuyXGetY ... на каждые buy_qty купленных free_qty бесплатно
+	PromotionBuyXGetY = "buy_x_get_y"
+)
+
+//Promotion ... правило скидки; пустые ProductID/Category означают "любой товар",
+//пустые Starts/Ends - без ограничения по времени; Active не передан при сохранении - не меняется
+type Promotion struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	Kind      string     `json:"kind"`
+	Value     int        `json:"value"`
+	BuyQty    int        `json:"buy_qty"`
+	FreeQty   int        `json:"free_qty"`
+	ProductID int64      `json:"product_id"`
+	Category  string     `json:"category"`
+	Starts    *time.Time `json:"starts"`
+	Ends      *time.Time `json:"ends"`
+	Active    *bool      `json:"active"`
+	Created   time.Time  `json:"created"`
+}
+
+//SaleDiscount ... скидка примененная к позиции продажи
+type SaleDiscount struct {
+	PromotionID int64  `json:"promotion_id"`
+	Name        string `json:"name"`
+	Amount      int    `json:"amount"`
+}
+
+//Discount ... считает сумму скидки для позиции qty x price; фиксированная скидка задана
+//в базовой валюте и переводится в валюту цены по курсу rate
+func (p *Promotion) Discount(price money.Money, qty int, rate float64) int {
+	total := price.Amount * qty
+	amount := 0
+	switch p.Kind {
+	case PromotionPercent:
+		amount = total * p.Value / 100
+	case PromotionFixed:
+		amount = money.FromBase(p.Value, price.Currency, rate).Amount * qty
+	case PromotionBuyXGetY:
+		if p.BuyQty > 0 && p.FreeQty > 0 {
+			amount = qty / (p.BuyQty + p.FreeQty) * p.FreeQty * price.Amount
+		}
+	}
+	if amount > total {
+		return total
+	}
+	return amount
+}
+
+func (p *Promotion) valid() bool {
+	if p.Name == "" || p.Value < 0 {
+		return false
+	}
+	if p.Starts != nil && p.Ends != nil && !p.Ends.After(*p.Starts) {
+		return false
+	}
+	switch p.Kind {
+	case PromotionPercent:
+		return p.Value > 0 && p.Value <= 100
+	case PromotionFixed:
+		return p.Value > 0
+	case PromotionBuyXGetY:
+		return p.BuyQty > 0 && p.FreeQty > 0
+	}
+	return false
+}
+
+//SavePromotion ...
+func (s *Service) SavePromotion(ctx context.Context, item *Promotion) (*Promotion, error) {
+	if !item.valid() {
+		return nil, types.ErrInvalidPromotion
+	}
+
+	var productID *int64
+	if item.ProductID != 0 {
+		productID = &item.ProductID
+	}
+	var category *string
+	if item.Category != "" {
+		category = &item.Category
+	}
+
+	var err error
+	if item.ID == 0 {
+		sqlstmt := `insert into promotions(name,kind,value,buy_qty,free_qty,product_id,category,starts,ends)
+		values ($1,$2,$3,$4,$5,$6,$7,$8,$9) returning id,active,created;`
+		err = s.db.QueryRow(ctx, sqlstmt, item.Name, item.Kind, item.Value, item.BuyQty, item.FreeQty,
+			productID, category, item.Starts, item.Ends).Scan(&item.ID, &item.Active, &item.Created)
+	} else {
+		sqlstmt := `update promotions set name=$2,kind=$3,value=$4,buy_qty=$5,free_qty=$6,product_id=$7,category=$8,
+		starts=$9,ends=$10,active=coalesce($11,active) where id = $1 returning active,created;`
+		err = s.db.QueryRow(ctx, sqlstmt, item.ID, item.Name, item.Kind, item.Value, item.BuyQty, item.FreeQty,
+			productID, category, item.Starts, item.Ends, item.Active).Scan(&item.Active, &item.Created)
+	}
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
+
+//Promotions ...
+func (s *Service) Promotions(ctx context.Context) ([]*Promotion, error) {
+	items := make([]*Promotion, 0)
+
+	sqlstmt := `select id,name,kind,value,buy_qty,free_qty,product_id,category,starts,ends,active,created
+	from promotions order by id limit 500`
+	rows, err := s.db.Query(ctx, sqlstmt)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanPromotion(rows)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+
+	return items, nil
+}
+
+//promotionsFor ... действующие сейчас акции для товара (по id или категории товара)
+func promotionsFor(ctx context.Context, q querier, productID int64) ([]*Promotion, error) {
+	items := make([]*Promotion, 0)
+
+	sqlstmt := `select pr.id,pr.name,pr.kind,pr.value,pr.buy_qty,pr.free_qty,pr.product_id,pr.category,pr.starts,pr.ends,pr.active,pr.created
+	from promotions pr
+	join products p on p.id = $1
+	where pr.active
+	and (pr.product_id is null or pr.product_id = p.id)
+	and (pr.category is null or pr.category = p.category)
+	and (pr.starts is null or pr.starts <= current_timestamp)
+	and (pr.ends is null or pr.ends > current_timestamp)`
+	rows, err := q.Query(ctx, sqlstmt, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanPromotion(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+//applyPromotions ... выбираем самую выгодную для покупателя акцию и записываем скидку в позицию
+func applyPromotions(ctx context.Context, q querier, position *SalePosition, rate float64) error {
+	promotions, err := promotionsFor(ctx, q, position.ProductID)
+	if err != nil {
+		return err
+	}
+
+	var best *Promotion
+	bestAmount := 0
+	for _, promotion := range promotions {
+		amount := promotion.Discount(position.Price, position.Qty, rate)
+		if amount > bestAmount {
+			best, bestAmount = promotion, amount
+		}
+	}
+
+	position.Discount = 0
+	position.Discounts = nil
+	if best != nil {
+		position.Discount = bestAmount
+		position.Discounts = []*SaleDiscount{{PromotionID: best.ID, Name: best.Name, Amount: bestAmount}}
+	}
+	return nil
+}
+
+func scanPromotion(rows pgx.Rows) (*Promotion, error) {
+	item := &Promotion{}
+	var productID *int64
+	var category *string
+	err := rows.Scan(&item.ID, &item.Name, &item.Kind, &item.Value, &item.BuyQty, &item.FreeQty,
+		&productID, &category, &item.Starts, &item.Ends, &item.Active, &item.Created)
+	if err != nil {
+		return nil, err
+	}
+	if productID != nil {
+		item.ProductID = *productID
+	}
+	if category != nil {
+		item.Category = *category
+	}
+	return item, nil
+}
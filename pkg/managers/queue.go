@@ -0,0 +1,136 @@
+package managers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/jackc/pgx/v4"
+)
+
+//Checkout ... оформляет корзину клиента черновиком продажи и ставит его в очередь активного менеджера
+//с наименьшим числом необработанных заказов; корзина очищается в той же транзакции.
+//Цены и наличие проверяются в транзакции: если цена товара отличается от той, что клиент видел
+//(carts_items.price), или товара не хватает, возвращается ErrCartChanged.
+//Товар резервируется на TTL, списание со склада и купон - при подтверждении менеджером
+func (s *Service) Checkout(ctx context.Context, customerID int64, coupon string) (*Sale, error) {
+	sale := &Sale{CustomerID: customerID, Coupon: coupon, Status: SaleDraft, Source: SaleSourceCart}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	//блокируем корзину, чтобы параллельный checkout не оформил её второй раз,
+	//а клиент не поменял её между проверкой и оформлением
+	err = tx.QueryRow(ctx, `select currency from carts where customer_id = $1 for update`, customerID).Scan(&sale.Currency)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrCartEmpty
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	accepted := make([]int, 0)
+	productIDs := make([]int64, 0)
+	rows, err := tx.Query(ctx, `select product_id, qty, price from carts_items where customer_id = $1 order by created for update`, customerID)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	for rows.Next() {
+		position := &SalePosition{}
+		var price int
+		if err = rows.Scan(&position.ProductID, &position.Qty, &price); err != nil {
+			rows.Close()
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		sale.Positions = append(sale.Positions, position)
+		accepted = append(accepted, price)
+		productIDs = append(productIDs, position.ProductID)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+	if len(sale.Positions) == 0 {
+		return nil, types.ErrCartEmpty
+	}
+	if err = s.prepareSale(ctx, sale); err != nil {
+		return nil, err
+	}
+
+	sqlstmt := `
+	select m.id from managers m
+	where m.active
+	order by (select count(*) from sales s where s.manager_id = m.id and s.status = 'draft' and s.source = 'cart'), m.id
+	limit 1`
+	err = tx.QueryRow(ctx, sqlstmt).Scan(&sale.ManagerID)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNoManagers
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	sqlstmt = `
+	insert into sales(manager_id,customer_id,currency,rate,coupon,status,source)
+	values ($1,$2,$3,$4,$5,$6,$7)
+	returning id, created`
+	err = tx.QueryRow(ctx, sqlstmt, sale.ManagerID, sale.CustomerID, sale.Currency, sale.Rate, sale.Coupon, sale.Status, sale.Source).
+		Scan(&sale.ID, &sale.Created)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	err = priceSale(ctx, tx, sale, nil)
+	if err == types.ErrInvalidPosition {
+		return nil, types.ErrCartChanged
+	}
+	if err != nil {
+		return nil, err
+	}
+	//каталожная цена в валюте корзины должна совпасть с той, что клиент принял
+	for i, position := range sale.Positions {
+		if position.ListPrice.Amount != accepted[i] {
+			return nil, types.ErrCartChanged
+		}
+	}
+
+	//держим товар под заказ, пока менеджер его не подтвердит (или не истечет TTL);
+	//срок считаем по часам базы, с ними же сравнивают резервы
+	var expires time.Time
+	err = tx.QueryRow(ctx, `select localtimestamp + $1 * interval '1 second'`, s.reservations.TTL.Seconds()).Scan(&expires)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	err = reserveStock(ctx, tx, sale.ID, sale.Positions, expires)
+	if err == types.ErrOutOfStock || err == types.ErrInvalidPosition {
+		return nil, types.ErrCartChanged
+	}
+	if err != nil {
+		return nil, err
+	}
+	sale.ReservedUntil = &expires
+
+	_, err = tx.Exec(ctx, `delete from carts_items where customer_id = $1 and product_id = any($2)`, customerID, productIDs)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	return sale, nil
+}
@@ -0,0 +1,86 @@
+package managers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/FaranushKarimov/crud/pkg/types"
+)
+
+func testCart(t *testing.T, s *Service, customerID, productID int64, qty, price int) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := s.db.Exec(ctx, `insert into carts (customer_id) values ($1)`, customerID); err != nil {
+		t.Fatalf("insert cart: %v", err)
+	}
+	_, err := s.db.Exec(ctx, `insert into carts_items (customer_id,product_id,qty,price) values ($1,$2,$3,$4)`, customerID, productID, qty, price)
+	if err != nil {
+		t.Fatalf("insert cart item: %v", err)
+	}
+}
+
+func TestCheckoutPriceChanged(t *testing.T) {
+	s := testService(t)
+	ctx := context.Background()
+
+	testManager(t, s)
+	customerID := testCustomer(t, s)
+	productID := testProduct(t, s, 120, 5)
+	//клиент принял цену 100, а в каталоге уже 120
+	testCart(t, s, customerID, productID, 1, 100)
+
+	if _, err := s.Checkout(ctx, customerID, ""); err != types.ErrCartChanged {
+		t.Fatalf("Checkout err = %v, want %v", err, types.ErrCartChanged)
+	}
+
+	items := 0
+	if err := s.db.QueryRow(ctx, `select count(*) from carts_items where customer_id = $1`, customerID).Scan(&items); err != nil {
+		t.Fatalf("select cart: %v", err)
+	}
+	if items != 1 {
+		t.Errorf("cart items = %d, want cart left as is", items)
+	}
+}
+
+func TestCheckoutOutOfStock(t *testing.T) {
+	s := testService(t)
+	ctx := context.Background()
+
+	testManager(t, s)
+	customerID := testCustomer(t, s)
+	productID := testProduct(t, s, 100, 1)
+	testCart(t, s, customerID, productID, 2, 100)
+
+	if _, err := s.Checkout(ctx, customerID, ""); err != types.ErrCartChanged {
+		t.Fatalf("Checkout err = %v, want %v", err, types.ErrCartChanged)
+	}
+}
+
+func TestCheckoutReservesCart(t *testing.T) {
+	s := testService(t)
+	ctx := context.Background()
+
+	testManager(t, s)
+	customerID := testCustomer(t, s)
+	productID := testProduct(t, s, 100, 3)
+	testCart(t, s, customerID, productID, 2, 100)
+
+	sale, err := s.Checkout(ctx, customerID, "")
+	if err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	if sale.Status != SaleDraft || sale.Source != SaleSourceCart || sale.ReservedUntil == nil {
+		t.Errorf("sale = %s/%s reserved %v, want draft cart order with reservation", sale.Status, sale.Source, sale.ReservedUntil)
+	}
+
+	reserved := 0
+	if err = s.db.QueryRow(ctx, `select coalesce(sum(qty),0) from stock_reservations where sale_id = $1`, sale.ID).Scan(&reserved); err != nil {
+		t.Fatalf("select reservations: %v", err)
+	}
+	if reserved != 2 {
+		t.Errorf("reserved = %d, want 2", reserved)
+	}
+	if _, err = s.Checkout(ctx, customerID, ""); err != types.ErrCartEmpty {
+		t.Errorf("second Checkout err = %v, want %v", err, types.ErrCartEmpty)
+	}
+}
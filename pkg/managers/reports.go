@@ -0,0 +1,189 @@
+package managers
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/money"
+	"github.com/FaranushKarimov/crud/pkg/types"
+)
+
+//группировки отчета по продажам
+const (
+	GroupDay        = "day"
+	GroupWeek       = "week"
+	GroupMonth      = "month"
+	GroupProduct    = "product"
+	GroupManager    = "manager"
+	GroupDepartment = "department"
+)
+
+//reportGroups ... ключ и название строки отчета для каждой группировки (l - строки продаж, m - менеджер,
+//d - отдел менеджера, p - товар); у менеджеров без отдела ключ 0
+var reportGroups = map[string]struct{ key, name string }{
+	GroupDay:        {`to_char(date_trunc('day', l.confirmed), 'YYYY-MM-DD')`, `''`},
+	GroupWeek:       {`to_char(date_trunc('week', l.confirmed), 'YYYY-MM-DD')`, `''`},
+	GroupMonth:      {`to_char(date_trunc('month', l.confirmed), 'YYYY-MM')`, `''`},
+	GroupProduct:    {`l.product_id::text`, `coalesce(p.name, '')`},
+	GroupManager:    {`l.manager_id::text`, `coalesce(m.name, '')`},
+	GroupDepartment: {`coalesce(m.department_id, 0)::text`, `coalesce(d.name, '')`},
+}
+
+//ReportRow ... Revenue - выручка в базовой валюте за вычетом возвратов, Units - проданные и не возвращенные штуки,
+//Sales - количество продаж
+type ReportRow struct {
+	Key     string `json:"key"`
+	Name    string `json:"name"`
+	Revenue int    `json:"revenue"`
+	Units   int    `json:"units"`
+	Sales   int    `json:"sales"`
+}
+
+//SalesReport ... отчет по проведенным продажам за период [From, To)
+type SalesReport struct {
+	Group    string       `json:"group"`
+	From     time.Time    `json:"from"`
+	To       time.Time    `json:"to"`
+	Currency string       `json:"currency"`
+	Rows     []*ReportRow `json:"rows"`
+	Total    *ReportRow   `json:"total"`
+}
+
+//SalesReport ... выручка, штуки и количество продаж по группировке group за период;
+//продажа попадает в период по времени подтверждения
+func (s *Service) SalesReport(ctx context.Context, group string, from, to time.Time) (*SalesReport, error) {
+	columns, ok := reportGroups[group]
+	if !ok {
+		return nil, types.ErrInvalidReport
+	}
+	report := &SalesReport{Group: group, From: from, To: to, Currency: money.Base, Rows: make([]*ReportRow, 0), Total: &ReportRow{}}
+
+	//суммы в валютах продаж, в базовую переводим по курсу каждой продажи
+	sqlstmt := `
+	with lines as (
+		select s.id sale_id, s.manager_id, s.currency, s.rate, s.confirmed, sp.product_id,
+		sp.qty - coalesce(rp.qty, 0) units,
+		sp.net + sp.tax - coalesce(rp.amount, 0) revenue
+		from sales s
+		join sales_positions sp on sp.sale_id = s.id
+		left join (
+			select position_id, sum(qty) qty, sum(net + tax) amount from returns_positions group by position_id
+		) rp on rp.position_id = sp.id
+		where s.status in ('confirmed', 'paid') and s.confirmed >= $1 and s.confirmed < $2
+	)
+	select ` + columns.key + `, ` + columns.name + `, l.currency, l.rate, sum(l.revenue), sum(l.units), count(distinct l.sale_id)
+	from lines l
+	left join managers m on m.id = l.manager_id
+	left join departments d on d.id = m.department_id
+	left join products p on p.id = l.product_id
+	group by 1, 2, l.currency, l.rate`
+	rows, err := s.db.Query(ctx, sqlstmt, from, to)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	byKey := make(map[string]*ReportRow)
+	sales := 0
+	for rows.Next() {
+		part := &ReportRow{}
+		revenue := money.Money{}
+		var rate float64
+		err = rows.Scan(&part.Key, &part.Name, &revenue.Currency, &rate, &revenue.Amount, &part.Units, &part.Sales)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+
+		row, ok := byKey[part.Key]
+		if !ok {
+			row = &ReportRow{Key: part.Key, Name: part.Name}
+			byKey[part.Key] = row
+			report.Rows = append(report.Rows, row)
+		}
+		row.Revenue += money.ToBase(revenue, rate)
+		row.Units += part.Units
+		row.Sales += part.Sales
+	}
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+
+	//продажа может попасть в несколько строк (по товарам), поэтому общее количество считаем отдельно
+	sqlstmt = `select count(*) from sales where status in ('confirmed', 'paid') and confirmed >= $1 and confirmed < $2`
+	if err = s.db.QueryRow(ctx, sqlstmt, from, to).Scan(&sales); err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	//периоды по порядку, остальное по убыванию выручки
+	sort.SliceStable(report.Rows, func(i, j int) bool {
+		if group == GroupDay || group == GroupWeek || group == GroupMonth {
+			return report.Rows[i].Key < report.Rows[j].Key
+		}
+		return report.Rows[i].Revenue > report.Rows[j].Revenue
+	})
+	for _, row := range report.Rows {
+		report.Total.Revenue += row.Revenue
+		report.Total.Units += row.Units
+	}
+	report.Total.Sales = sales
+	return report, nil
+}
+
+//netRevenue ... выручка без налога за вычетом возвратов в базовой валюте по менеджерам и категориям
+//за период [from, to), продажа попадает в период по времени подтверждения; это единая база
+//для комиссий и для выполнения планов менеджеров и отделов
+func netRevenue(ctx context.Context, q querier, from, to time.Time) (map[int64]map[string]int, error) {
+	sqlstmt := `
+	select s.manager_id, coalesce(p.category, ''), s.currency, s.rate,
+	sum(sp.net - coalesce((select sum(rp.net) from returns_positions rp where rp.position_id = sp.id), 0))
+	from sales s
+	join sales_positions sp on sp.sale_id = s.id
+	left join products p on p.id = sp.product_id
+	where s.status in ('confirmed', 'paid') and s.confirmed >= $1 and s.confirmed < $2
+	group by 1, 2, 3, 4`
+	rows, err := q.Query(ctx, sqlstmt, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revenue := make(map[int64]map[string]int)
+	for rows.Next() {
+		var managerID int64
+		var category string
+		var rate float64
+		amount := money.Money{}
+		if err = rows.Scan(&managerID, &category, &amount.Currency, &rate, &amount.Amount); err != nil {
+			return nil, err
+		}
+		if revenue[managerID] == nil {
+			revenue[managerID] = make(map[string]int)
+		}
+		revenue[managerID][category] += money.ToBase(amount, rate)
+	}
+	return revenue, rows.Err()
+}
+
+//revenueTotal ... выручка менеджера по всем категориям
+func revenueTotal(byCategory map[string]int) int {
+	total := 0
+	for _, amount := range byCategory {
+		total += amount
+	}
+	return total
+}
+
+//revenueManagers ... менеджеры, у которых есть выручка
+func revenueManagers(revenue map[int64]map[string]int) []int64 {
+	ids := make([]int64, 0, len(revenue))
+	for id := range revenue {
+		ids = append(ids, id)
+	}
+	return ids
+}
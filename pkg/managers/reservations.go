@@ -0,0 +1,132 @@
+package managers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/jackc/pgx/v4"
+)
+
+//ReservationConfig ... TTL - сколько держим товар под заказ из корзины до подтверждения менеджером,
+//SweepInterval - как часто фоновая задача удаляет просроченные резервы
+type ReservationConfig struct {
+	TTL           time.Duration
+	SweepInterval time.Duration
+}
+
+//ReservationConfigFromEnv ... настройки из RESERVATION_TTL и RESERVATION_SWEEP_INTERVAL
+//(формат time.ParseDuration, например 30m), по умолчанию 30 минут и 1 минута
+func ReservationConfigFromEnv() *ReservationConfig {
+	config := &ReservationConfig{TTL: 30 * time.Minute, SweepInterval: time.Minute}
+	if value, err := time.ParseDuration(os.Getenv("RESERVATION_TTL")); err == nil && value > 0 {
+		config.TTL = value
+	}
+	if value, err := time.ParseDuration(os.Getenv("RESERVATION_SWEEP_INTERVAL")); err == nil && value > 0 {
+		config.SweepInterval = value
+	}
+	return config
+}
+
+//reservedQty ... сколько штук товара p держат действующие резервы других продаж ($n - id своей продажи)
+const reservedQty = `coalesce((select sum(sr.qty) from stock_reservations sr
+	where sr.product_id = p.id and sr.sale_id <> $%d and sr.expires > current_timestamp),0)`
+
+//reserveStock ... резервирует товар под продажу до expires; доступный остаток (на складе минус
+//чужие действующие резервы) проверяется под блокировкой строк товаров по порядку id
+func reserveStock(ctx context.Context, tx pgx.Tx, saleID int64, positions []*SalePosition, expires time.Time) error {
+	qty := make(map[int64]int)
+	ids := make([]int64, 0)
+	for _, position := range positions {
+		if _, ok := qty[position.ProductID]; !ok {
+			ids = append(ids, position.ProductID)
+		}
+		qty[position.ProductID] += position.Qty
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		var available int
+		active := false
+		err := tx.QueryRow(ctx, `select p.qty - `+fmt.Sprintf(reservedQty, 2)+`, p.active from products p where p.id = $1 for update`, id, saleID).
+			Scan(&available, &active)
+		if err == pgx.ErrNoRows || err == nil && !active {
+			return types.ErrInvalidPosition
+		}
+		if err != nil {
+			log.Print(err)
+			return types.ErrInternal
+		}
+		if available < qty[id] {
+			return types.ErrOutOfStock
+		}
+
+		_, err = tx.Exec(ctx, `insert into stock_reservations (product_id, sale_id, qty, expires) values ($1, $2, $3, $4)`,
+			id, saleID, qty[id], expires)
+		if err != nil {
+			log.Print(err)
+			return types.ErrInternal
+		}
+	}
+	return nil
+}
+
+//releaseReservations ... снимает резервы продажи (товар списан при подтверждении или заказ отменен)
+func releaseReservations(ctx context.Context, tx pgx.Tx, saleID int64) error {
+	if _, err := tx.Exec(ctx, `delete from stock_reservations where sale_id = $1`, saleID); err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//rereserveStock ... после правки черновика переносит его действующие резервы на новые позиции
+//с тем же сроком; черновик без резервов (или с просроченными) не трогаем
+func rereserveStock(ctx context.Context, tx pgx.Tx, sale *Sale) error {
+	var expires *time.Time
+	err := tx.QueryRow(ctx, `select min(expires) from stock_reservations where sale_id = $1 and expires > current_timestamp`, sale.ID).
+		Scan(&expires)
+	if err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	if err = releaseReservations(ctx, tx, sale.ID); err != nil {
+		return err
+	}
+	if expires == nil {
+		return nil
+	}
+	return reserveStock(ctx, tx, sale.ID, sale.Positions, *expires)
+}
+
+//SweepReservations ... удаляет просроченные резервы и возвращает их количество
+func (s *Service) SweepReservations(ctx context.Context) (int64, error) {
+	tag, err := s.db.Exec(ctx, `delete from stock_reservations where expires <= current_timestamp`)
+	if err != nil {
+		log.Print(err)
+		return 0, types.ErrInternal
+	}
+	return tag.RowsAffected(), nil
+}
+
+//RunReservationSweeper ... фоновая задача: раз в SweepInterval освобождает просроченные резервы, пока жив ctx
+func (s *Service) RunReservationSweeper(ctx context.Context) {
+	ticker := time.NewTicker(s.reservations.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			count, err := s.SweepReservations(ctx)
+			if err == nil && count > 0 {
+				log.Printf("released %d expired stock reservations", count)
+			}
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package managers
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/money"
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/jackc/pgx/v4"
+)
+
+//Return ... возврат по продаже SaleID; Refund - сумма к возврату покупателю в валюте продажи,
+//Loyalty - её часть, оплаченная баллами: она возвращается баллами, остальное - деньгами,
+//а при StoreCredit зачисляется на баланс покупателя (в базовой валюте по курсу продажи)
+type Return struct {
+	ID          int64             `json:"id"`
+	SaleID      int64             `json:"sale_id"`
+	ManagerID   int64             `json:"manager_id"`
+	Reason      string            `json:"reason"`
+	Currency    string            `json:"currency"`
+	Refund      int               `json:"refund"`
+	Loyalty     int               `json:"loyalty"`
+	StoreCredit bool              `json:"store_credit"`
+	Created     time.Time         `json:"created"`
+	Positions   []*ReturnPosition `json:"positions"`
+}
+
+//ReturnPosition ... возвращаемое количество Qty по позиции продажи PositionID;
+//Net и Tax - доля позиции, приходящаяся на возвращаемое количество, Refund - часть возврата Return.Refund по ней
+type ReturnPosition struct {
+	ID         int64     `json:"id"`
+	ReturnID   int64     `json:"return_id"`
+	PositionID int64     `json:"position_id"`
+	ProductID  int64     `json:"product_id"`
+	Qty        int       `json:"qty"`
+	Net        int       `json:"net"`
+	Tax        int       `json:"tax"`
+	Refund     int       `json:"refund"`
+	Created    time.Time `json:"created"`
+}
+
+//MakeReturn ... оформляет возврат: проверяет что не возвращают больше проданного,
+//возвращает товар на склад, снимает баллы за возвращенное и считает сумму возврата; покупателю возвращается не больше,
+//чем он оплатил сверх стоимости оставшегося товара, остальное просто уменьшает остаток к оплате
+func (s *Service) MakeReturn(ctx context.Context, ret *Return) (*Return, error) {
+	if len(ret.Positions) == 0 {
+		return nil, types.ErrInvalidReturn
+	}
+	seen := make(map[int64]bool)
+	for _, position := range ret.Positions {
+		if position.Qty <= 0 || seen[position.PositionID] {
+			return nil, types.ErrInvalidReturn
+		}
+		seen[position.PositionID] = true
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	//блокируем продажу, чтобы параллельные возвраты по ней шли по очереди
+	status := ""
+	var customerID *int64
+	var rate float64
+	err = tx.QueryRow(ctx, `select currency, rate, status, customer_id from sales where id = $1 for update`, ret.SaleID).
+		Scan(&ret.Currency, &rate, &status, &customerID)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	//вернуть можно только проведенный товар
+	if status != SaleConfirmed && status != SalePaid {
+		return nil, types.ErrSaleStatus
+	}
+	//на баланс можно зачислить только покупателю с карточкой
+	if ret.StoreCredit && customerID == nil {
+		return nil, types.ErrAnonymousCustomer
+	}
+
+	balance, err := saleBalance(ctx, tx, ret.SaleID)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	value := 0
+	values := make([]int, len(ret.Positions))
+	for i, position := range ret.Positions {
+		var sold, returned, net, tax int
+		sqlstmt := `
+		select sp.product_id, sp.qty, sp.net, sp.tax,
+		coalesce((select sum(rp.qty) from returns_positions rp where rp.position_id = sp.id),0)
+		from sales_positions sp
+		where sp.id = $1 and sp.sale_id = $2`
+		err = tx.QueryRow(ctx, sqlstmt, position.PositionID, ret.SaleID).Scan(&position.ProductID, &sold, &net, &tax, &returned)
+		if err == pgx.ErrNoRows {
+			return nil, types.ErrInvalidReturn
+		}
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		if returned+position.Qty > sold {
+			return nil, types.ErrReturnExceedsSold
+		}
+
+		position.Net = refundShare(net, sold, returned, position.Qty)
+		position.Tax = refundShare(tax, sold, returned, position.Qty)
+		values[i] = position.Net + position.Tax
+		value += values[i]
+	}
+
+	//неоплаченную часть продажи покупателю не возвращаем
+	ret.Refund = value - balance
+	if ret.Refund > value {
+		ret.Refund = value
+	}
+	if ret.Refund < 0 {
+		ret.Refund = 0
+	}
+	refunds := allocate(ret.Refund, values)
+	for i, position := range ret.Positions {
+		position.Refund = refunds[i]
+	}
+	loyaltyPayment, err := loyaltyShare(ctx, tx, ret)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	sqlstmt := `insert into returns (sale_id,manager_id,reason,refund,loyalty,store_credit) values ($1,$2,$3,$4,$5,$6) returning id, created`
+	err = tx.QueryRow(ctx, sqlstmt, ret.SaleID, ret.ManagerID, ret.Reason, ret.Refund, ret.Loyalty, ret.StoreCredit).Scan(&ret.ID, &ret.Created)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	for _, position := range ret.Positions {
+		position.ReturnID = ret.ID
+		err = tx.QueryRow(ctx, `insert into returns_positions (return_id,position_id,qty,net,tax) values ($1,$2,$3,$4,$5) returning id, created`,
+			position.ReturnID, position.PositionID, position.Qty, position.Net, position.Tax).Scan(&position.ID, &position.Created)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+	}
+
+	if err = putStock(ctx, tx, ret.Positions); err != nil {
+		return nil, err
+	}
+	if err = returnPoints(ctx, tx, ret, rate); err != nil {
+		return nil, err
+	}
+
+	//оплаченное баллами возвращаем баллами
+	if points := money.ToBase(money.New(ret.Loyalty, ret.Currency), rate); points > 0 && customerID != nil {
+		if err = s.refundPoints(ctx, tx, *customerID, ret.SaleID, loyaltyPayment, points); err != nil {
+			return nil, err
+		}
+	}
+
+	if ret.StoreCredit {
+		_, err = tx.Exec(ctx, `update customers set credit = credit + $1 where id = $2`,
+			money.ToBase(money.New(ret.Refund-ret.Loyalty, ret.Currency), rate), *customerID)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+	}
+
+	//если оплаты покрывают уменьшенную сумму продажи, она оплачена
+	if status == SaleConfirmed {
+		balance, err = saleBalance(ctx, tx, ret.SaleID)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		if balance <= 0 {
+			_, err = tx.Exec(ctx, `update sales set status = $2, paid = current_timestamp where id = $1`, ret.SaleID, SalePaid)
+			if err != nil {
+				log.Print(err)
+				return nil, types.ErrInternal
+			}
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	return ret, nil
+}
+
+//Returns ... возвраты по продаже
+func (s *Service) Returns(ctx context.Context, saleID int64) ([]*Return, error) {
+	items := make([]*Return, 0)
+	byID := make(map[int64]*Return)
+
+	sqlstmt := `
+	select r.id, r.sale_id, r.manager_id, r.reason, s.currency, r.refund, r.loyalty, r.store_credit, r.created
+	from returns r
+	join sales s on s.id = r.sale_id
+	where r.sale_id = $1
+	order by r.id`
+	rows, err := s.db.Query(ctx, sqlstmt, saleID)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Return{Positions: make([]*ReturnPosition, 0)}
+		err = rows.Scan(&item.ID, &item.SaleID, &item.ManagerID, &item.Reason, &item.Currency, &item.Refund, &item.Loyalty, &item.StoreCredit, &item.Created)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+		byID[item.ID] = item
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+
+	sqlstmt = `
+	select rp.id, rp.return_id, rp.position_id, sp.product_id, rp.qty, rp.net, rp.tax, rp.created
+	from returns_positions rp
+	join returns r on r.id = rp.return_id
+	join sales_positions sp on sp.id = rp.position_id
+	where r.sale_id = $1
+	order by rp.id`
+	rows, err = s.db.Query(ctx, sqlstmt, saleID)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &ReturnPosition{}
+		err = rows.Scan(&item.ID, &item.ReturnID, &item.PositionID, &item.ProductID, &item.Qty, &item.Net, &item.Tax, &item.Created)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		if ret, ok := byID[item.ReturnID]; ok {
+			ret.Positions = append(ret.Positions, item)
+		}
+	}
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+
+	//сумма возврата делится по позициям так же, как при оформлении
+	for _, item := range items {
+		values := make([]int, len(item.Positions))
+		for i, position := range item.Positions {
+			values[i] = position.Net + position.Tax
+		}
+		refunds := allocate(item.Refund, values)
+		for i, position := range item.Positions {
+			position.Refund = refunds[i]
+		}
+	}
+
+	return items, nil
+}
+
+//loyaltyShare ... часть возврата ret.Refund, оплаченная баллами, - в той же доле, что баллы в оплатах продажи;
+//считаем от накопленной суммы возвратов, чтобы в итоге вернуть баллами ровно оплаченное баллами;
+//возвращает последнюю оплату баллами, к ней привязываются возвращенные баллы
+func loyaltyShare(ctx context.Context, tx pgx.Tx, ret *Return) (paymentID int64, err error) {
+	var paid, loyalty, refunded int
+	sqlstmt := `
+	select coalesce(sum(amount),0), coalesce(sum(amount) filter (where method = $2),0),
+	coalesce(max(id) filter (where method = $2),0),
+	coalesce((select sum(r.refund) from returns r where r.sale_id = $1),0)
+	from payments where sale_id = $1`
+	err = tx.QueryRow(ctx, sqlstmt, ret.SaleID, PaymentLoyalty).Scan(&paid, &loyalty, &paymentID, &refunded)
+	if err != nil {
+		return 0, err
+	}
+
+	ret.Loyalty = 0
+	if paid > 0 && loyalty > 0 {
+		ret.Loyalty = divRound(loyalty*(refunded+ret.Refund), paid) - divRound(loyalty*refunded, paid)
+	}
+	return paymentID, nil
+}
+
+//refundShare ... доля amount за qty штук из sold, если returned уже вернули;
+//считаем от накопленного количества, чтобы при полном возврате сумма совпала до копейки
+func refundShare(amount, sold, returned, qty int) int {
+	return divRound(amount*(returned+qty), sold) - divRound(amount*returned, sold)
+}
+
+//putStock ... возвращает товар на склад, в том же порядке блокировок что и takeStock
+func putStock(ctx context.Context, tx pgx.Tx, positions []*ReturnPosition) error {
+	sorted := make([]*ReturnPosition, len(positions))
+	copy(sorted, positions)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].ProductID < sorted[j].ProductID })
+
+	for _, position := range sorted {
+		_, err := tx.Exec(ctx, `update products set qty = qty + $1, version = version + 1 where id = $2`,
+			position.Qty, position.ProductID)
+		if err != nil {
+			log.Print(err)
+			return types.ErrInternal
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package managers
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMakeReturnUnpaidReducesBalance(t *testing.T) {
+	s := testService(t)
+	ctx := context.Background()
+
+	managerID := testManager(t, s)
+	productID := testProduct(t, s, 100, 5)
+
+	sale, err := s.MakeSale(ctx, &Sale{
+		ManagerID: managerID,
+		Anonymous: true,
+		Positions: []*SalePosition{{ProductID: productID, Qty: 2}},
+	})
+	if err != nil {
+		t.Fatalf("MakeSale: %v", err)
+	}
+
+	ret, err := s.MakeReturn(ctx, &Return{
+		SaleID:    sale.ID,
+		ManagerID: managerID,
+		Positions: []*ReturnPosition{{PositionID: sale.Positions[0].ID, Qty: 1}},
+	})
+	if err != nil {
+		t.Fatalf("MakeReturn: %v", err)
+	}
+	if ret.Refund != 0 {
+		t.Errorf("Refund = %d, want 0 for unpaid sale", ret.Refund)
+	}
+
+	sale, err = s.SaleByID(ctx, sale.ID)
+	if err != nil {
+		t.Fatalf("SaleByID: %v", err)
+	}
+	if sale.Balance != 100 {
+		t.Errorf("Balance = %d, want 100 for the kept item", sale.Balance)
+	}
+}
+
+func TestMakeReturnRefundsOnlyPaid(t *testing.T) {
+	s := testService(t)
+	ctx := context.Background()
+
+	managerID := testManager(t, s)
+	productID := testProduct(t, s, 100, 5)
+
+	sale, err := s.MakeSale(ctx, &Sale{
+		ManagerID: managerID,
+		Anonymous: true,
+		Positions: []*SalePosition{{ProductID: productID, Qty: 2}},
+	})
+	if err != nil {
+		t.Fatalf("MakeSale: %v", err)
+	}
+	if _, err = s.AddPayments(ctx, sale.ID, managerID, []*Payment{{Method: PaymentCard, Amount: 150}}); err != nil {
+		t.Fatalf("AddPayments: %v", err)
+	}
+
+	ret, err := s.MakeReturn(ctx, &Return{
+		SaleID:    sale.ID,
+		ManagerID: managerID,
+		Positions: []*ReturnPosition{{PositionID: sale.Positions[0].ID, Qty: 1}},
+	})
+	if err != nil {
+		t.Fatalf("MakeReturn: %v", err)
+	}
+	if ret.Refund != 50 {
+		t.Errorf("Refund = %d, want 50 paid over the kept item", ret.Refund)
+	}
+
+	sale, err = s.SaleByID(ctx, sale.ID)
+	if err != nil {
+		t.Fatalf("SaleByID: %v", err)
+	}
+	if sale.Balance != 0 || sale.Status != SalePaid {
+		t.Errorf("Balance = %d, Status = %s, want 0 and %s", sale.Balance, sale.Status, SalePaid)
+	}
+}
@@ -0,0 +1,500 @@
+package managers
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/money"
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/jackc/pgx/v4"
+)
+
+//статусы продажи: черновик можно править, подтвержденная списала товар со склада,
+//отмена подтвержденной возвращает товар на склад
+const (
+	SaleDraft     = "draft"
+	SaleConfirmed = "confirmed"
+	SalePaid      = "paid"
+	SaleCancelled = "cancelled"
+)
+
+//откуда пришла продажа: оформлена менеджером или заказ клиента из корзины
+const (
+	SaleSourceManager = "manager"
+	SaleSourceCart    = "cart"
+)
+
+//saleTransitions ... допустимые переходы между статусами
+var saleTransitions = map[string][]string{
+	SaleDraft:     {SaleConfirmed, SaleCancelled},
+	SaleConfirmed: {SalePaid, SaleCancelled},
+}
+
+//SalesFilter ... нулевые значения означают "без фильтра", период [From, To)
+type SalesFilter struct {
+	ManagerID  int64
+	CustomerID int64
+	ProductID  int64
+	Status     string
+	Source     string
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+	Offset     int
+}
+
+//SalesPage ... страница продаж и общее количество по фильтру
+type SalesPage struct {
+	Items  []*Sale `json:"items"`
+	Count  int     `json:"count"`
+	Limit  int     `json:"limit"`
+	Offset int     `json:"offset"`
+}
+
+//saleHeaderColumns ... шапка продажи вместе с итогами по позициям и купону
+const saleHeaderColumns = `
+	s.id, s.manager_id, coalesce(s.customer_id,0), s.currency, s.rate, s.status, s.source, s.created, s.confirmed, s.paid, s.cancelled,
+	s.coupon, coalesce(r.amount,0),
+	coalesce((select sum(sp.tax) from sales_positions sp where sp.sale_id = s.id),0),
+	coalesce((select sum(sp.net + sp.tax) from sales_positions sp where sp.sale_id = s.id),0),
+	coalesce((select sum(rp.net + rp.tax) from returns_positions rp join returns r on r.id = rp.return_id where r.sale_id = s.id),0),
+	coalesce((select sum(r.refund) from returns r where r.sale_id = s.id),0),
+	coalesce((select sum(pm.amount) from payments pm where pm.sale_id = s.id),0),
+	(select min(sr.expires) from stock_reservations sr where sr.sale_id = s.id and sr.expires > current_timestamp)
+	from sales s
+	left join coupons_redemptions r on r.sale_id = s.id`
+
+//Sales ... список продаж по фильтру, новые сверху
+func (s *Service) Sales(ctx context.Context, filter *SalesFilter) (*SalesPage, error) {
+	if filter.Limit <= 0 || filter.Limit > 500 {
+		filter.Limit = 50
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	page := &SalesPage{Items: make([]*Sale, 0), Limit: filter.Limit, Offset: filter.Offset}
+
+	where, args := salesWhere(filter)
+
+	err := s.db.QueryRow(ctx, `select count(*) from sales s `+where, args...).Scan(&page.Count)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	sqlstmt := `select ` + saleHeaderColumns + ` ` + where +
+		` order by s.id desc limit $` + strconv.Itoa(len(args)-1) + ` offset $` + strconv.Itoa(len(args))
+	rows, err := s.db.Query(ctx, sqlstmt, args...)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanSaleHeader(rows)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		page.Items = append(page.Items, item)
+	}
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+
+	return page, nil
+}
+
+//SaleByID ... продажа с позициями (с названиями товаров), скидками и налоговой расшифровкой
+func (s *Service) SaleByID(ctx context.Context, id int64) (*Sale, error) {
+	sale, err := scanSaleHeader(s.db.QueryRow(ctx, `select `+saleHeaderColumns+` where s.id = $1`, id))
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	sale.Positions, err = salePositions(ctx, s.db, sale)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	sale.Taxes = taxBreakdown(sale.Positions)
+
+	sale.Payments, err = salePayments(ctx, s.db, sale.ID)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	return sale, nil
+}
+
+//UpdateSale ... заменяет позиции, покупателя, валюту и купон черновика
+func (s *Service) UpdateSale(ctx context.Context, sale *Sale) (*Sale, error) {
+	if err := s.prepareSale(ctx, sale); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	status := ""
+	err = tx.QueryRow(ctx, `select status from sales where id = $1 for update`, sale.ID).Scan(&status)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	if status != SaleDraft {
+		return nil, types.ErrSaleStatus
+	}
+
+	if err = deletePositions(ctx, tx, sale.ID); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(ctx, `update sales set customer_id = nullif($2,0), currency = $3, rate = $4, coupon = $5 where id = $1`,
+		sale.ID, sale.CustomerID, sale.Currency, sale.Rate, sale.Coupon)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	if err = priceSale(ctx, tx, sale, nil); err != nil {
+		return nil, err
+	}
+	if err = rereserveStock(ctx, tx, sale); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	return s.SaleByID(ctx, sale.ID)
+}
+
+//ChangeSaleStatus ... переводит продажу в статус status, если переход допустим:
+//подтверждение черновика пересчитывает цены по текущему каталогу, списывает товар и гасит купон,
+//отмена подтвержденной продажи возвращает на склад невозвращенный товар и освобождает купон,
+//отмена черновика снимает его резерв
+func (s *Service) ChangeSaleStatus(ctx context.Context, id int64, status string) (*Sale, error) {
+	switch status {
+	case SaleDraft, SaleConfirmed, SalePaid, SaleCancelled:
+	default:
+		return nil, types.ErrInvalidStatus
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	sale := &Sale{ID: id}
+	err = tx.QueryRow(ctx, `select manager_id, coalesce(customer_id,0), currency, coupon, status from sales where id = $1 for update`, id).
+		Scan(&sale.ManagerID, &sale.CustomerID, &sale.Currency, &sale.Coupon, &sale.Status)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	allowed := false
+	for _, next := range saleTransitions[sale.Status] {
+		allowed = allowed || next == status
+	}
+	if !allowed {
+		return nil, types.ErrSaleStatus
+	}
+
+	switch {
+	case sale.Status == SaleDraft && status == SaleConfirmed:
+		err = s.confirmDraft(ctx, tx, sale)
+	case sale.Status == SaleConfirmed && status == SalePaid:
+		err = checkPaid(ctx, tx, sale.ID)
+	case sale.Status == SaleConfirmed && status == SaleCancelled:
+		err = releaseSale(ctx, tx, sale.ID)
+	case sale.Status == SaleDraft && status == SaleCancelled:
+		err = releaseReservations(ctx, tx, sale.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sqlstmt := `
+	update sales set status = $2,
+	confirmed = case when $2 = 'confirmed' then current_timestamp else confirmed end,
+	paid = case when $2 = 'paid' then current_timestamp else paid end,
+	cancelled = case when $2 = 'cancelled' then current_timestamp else cancelled end
+	where id = $1`
+	if _, err = tx.Exec(ctx, sqlstmt, id, status); err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	return s.SaleByID(ctx, id)
+}
+
+//confirmDraft ... заново проводит позиции черновика (с сохранением ручных цен) по текущему курсу
+func (s *Service) confirmDraft(ctx context.Context, tx pgx.Tx, sale *Sale) error {
+	var err error
+	sale.Rate, err = s.exchangeRate(ctx, sale.Currency)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(ctx, `select product_id, qty, price, override_reason from sales_positions where sale_id = $1 order by id`, sale.ID)
+	if err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var price int
+		position := &SalePosition{}
+		if err = rows.Scan(&position.ProductID, &position.Qty, &price, &position.OverrideReason); err != nil {
+			log.Print(err)
+			return types.ErrInternal
+		}
+		if position.OverrideReason != "" {
+			override := money.New(price, sale.Currency)
+			position.OverridePrice = &override
+		}
+		sale.Positions = append(sale.Positions, position)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return types.ErrInternal
+	}
+	if len(sale.Positions) == 0 {
+		return types.ErrInvalidPosition
+	}
+
+	if err = deletePositions(ctx, tx, sale.ID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, `update sales set rate = $2 where id = $1`, sale.ID, sale.Rate); err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	return s.confirmSale(ctx, tx, sale)
+}
+
+//checkPaid ... вручную отметить оплаченной можно только продажу без остатка к оплате
+func checkPaid(ctx context.Context, tx pgx.Tx, saleID int64) error {
+	balance, err := saleBalance(ctx, tx, saleID)
+	if err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	if balance > 0 {
+		return types.ErrBalanceDue
+	}
+	return nil
+}
+
+//releaseSale ... возвращает на склад то, что еще не вернули по возвратам, освобождает купон
+//и снимает начисленные баллы;
+//отменить продажу, по которой уже есть оплаты, нельзя
+func releaseSale(ctx context.Context, tx pgx.Tx, saleID int64) error {
+	paid := false
+	err := tx.QueryRow(ctx, `select exists(select 1 from payments where sale_id = $1)`, saleID).Scan(&paid)
+	if err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	if paid {
+		return types.ErrSaleHasPayments
+	}
+
+	sqlstmt := `
+	select sp.product_id, sp.qty - coalesce((select sum(rp.qty) from returns_positions rp where rp.position_id = sp.id),0)
+	from sales_positions sp
+	where sp.sale_id = $1`
+	rows, err := tx.Query(ctx, sqlstmt, saleID)
+	if err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	defer rows.Close()
+
+	positions := make([]*ReturnPosition, 0)
+	for rows.Next() {
+		position := &ReturnPosition{}
+		if err = rows.Scan(&position.ProductID, &position.Qty); err != nil {
+			log.Print(err)
+			return types.ErrInternal
+		}
+		if position.Qty > 0 {
+			positions = append(positions, position)
+		}
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return types.ErrInternal
+	}
+
+	if err = putStock(ctx, tx, positions); err != nil {
+		return err
+	}
+
+	sqlstmt = `
+	with redemptions as (
+		delete from coupons_redemptions where sale_id = $1 returning coupon_id
+	)
+	update coupons c set used = c.used - 1
+	from redemptions r
+	where c.id = r.coupon_id and c.used > 0`
+	if _, err = tx.Exec(ctx, sqlstmt, saleID); err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	return reversePoints(ctx, tx, saleID)
+}
+
+//deletePositions ... удаляет позиции продажи вместе со скидками (для пересчета черновика)
+func deletePositions(ctx context.Context, tx pgx.Tx, saleID int64) error {
+	_, err := tx.Exec(ctx, `delete from sales_positions_discounts where position_id in (select id from sales_positions where sale_id = $1)`, saleID)
+	if err == nil {
+		_, err = tx.Exec(ctx, `delete from sales_positions where sale_id = $1`, saleID)
+	}
+	if err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	return nil
+}
+
+//salePositions ... позиции продажи со скидками по акциям
+func salePositions(ctx context.Context, q querier, sale *Sale) ([]*SalePosition, error) {
+	positions := make([]*SalePosition, 0)
+	byID := make(map[int64]*SalePosition)
+
+	sqlstmt := `
+	select sp.id, sp.product_id, coalesce(p.name,''), sp.price, sp.list_price, sp.override_reason, sp.qty,
+	coalesce((select sum(rp.qty) from returns_positions rp where rp.position_id = sp.id),0), sp.discount, sp.tax_rate, sp.tax_exclusive, sp.net, sp.tax, sp.created
+	from sales_positions sp
+	left join products p on p.id = sp.product_id
+	where sp.sale_id = $1
+	order by sp.id`
+	rows, err := q.Query(ctx, sqlstmt, sale.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &SalePosition{SaleID: sale.ID, Discounts: make([]*SaleDiscount, 0)}
+		item.Price.Currency, item.ListPrice.Currency = sale.Currency, sale.Currency
+		err = rows.Scan(&item.ID, &item.ProductID, &item.ProductName, &item.Price.Amount, &item.ListPrice.Amount,
+			&item.OverrideReason, &item.Qty, &item.Returned, &item.Discount, &item.TaxRate, &item.TaxExclusive, &item.Net, &item.Tax, &item.Created)
+		if err != nil {
+			return nil, err
+		}
+		positions = append(positions, item)
+		byID[item.ID] = item
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	sqlstmt = `
+	select d.position_id, d.promotion_id, pr.name, d.amount
+	from sales_positions_discounts d
+	join sales_positions sp on sp.id = d.position_id
+	join promotions pr on pr.id = d.promotion_id
+	where sp.sale_id = $1
+	order by d.id`
+	rows, err = q.Query(ctx, sqlstmt, sale.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var positionID int64
+		item := &SaleDiscount{}
+		if err = rows.Scan(&positionID, &item.PromotionID, &item.Name, &item.Amount); err != nil {
+			return nil, err
+		}
+		if position, ok := byID[positionID]; ok {
+			position.Discounts = append(position.Discounts, item)
+		}
+	}
+
+	return positions, rows.Err()
+}
+
+//salesWhere ... условие по фильтру, все значения передаются параметрами
+func salesWhere(filter *SalesFilter) (string, []interface{}) {
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.Replace(condition, "?", "$"+strconv.Itoa(len(args)), 1))
+	}
+
+	if filter.ManagerID != 0 {
+		add("s.manager_id = ?", filter.ManagerID)
+	}
+	if filter.CustomerID != 0 {
+		add("s.customer_id = ?", filter.CustomerID)
+	}
+	if filter.Status != "" {
+		add("s.status = ?", filter.Status)
+	}
+	if filter.Source != "" {
+		add("s.source = ?", filter.Source)
+	}
+	if filter.ProductID != 0 {
+		add("exists (select 1 from sales_positions sp where sp.sale_id = s.id and sp.product_id = ?)", filter.ProductID)
+	}
+	if filter.From != nil {
+		add("s.created >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		add("s.created < ?", *filter.To)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "where " + strings.Join(conditions, " and "), args
+}
+
+func scanSaleHeader(row pgx.Row) (*Sale, error) {
+	item := &Sale{}
+	err := row.Scan(&item.ID, &item.ManagerID, &item.CustomerID, &item.Currency, &item.Rate,
+		&item.Status, &item.Source, &item.Created, &item.Confirmed, &item.Paid, &item.Cancelled, &item.Coupon, &item.CouponDiscount, &item.Tax, &item.Total, &item.Returned, &item.Refunded, &item.PaymentsTotal, &item.ReservedUntil)
+	if err != nil {
+		return nil, err
+	}
+	item.Balance = item.Total - item.Returned - (item.PaymentsTotal - item.Refunded)
+	item.Anonymous = item.CustomerID == 0
+	return item, nil
+}
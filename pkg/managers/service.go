@@ -2,12 +2,16 @@ package managers
 
 import (
 	"context"
+	"fmt"
 	"log"
-	"strconv"
+	"sort"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/FaranushKarimov/crud/pkg/blob"
+	"github.com/FaranushKarimov/crud/pkg/money"
 	"github.com/FaranushKarimov/crud/pkg/types"
 	"github.com/FaranushKarimov/crud/pkg/utils"
 	"github.com/jackc/pgx/v4"
@@ -16,63 +20,118 @@ import (
 
 //Service ...
 type Service struct {
-	db *pgxpool.Pool
+	db           *pgxpool.Pool
+	blobs        blob.Store
+	reservations *ReservationConfig
+	loyalty      *LoyaltyConfig
 }
 
 //NewService ...
-func NewService(db *pgxpool.Pool) *Service {
-	return &Service{db: db}
+func NewService(db *pgxpool.Pool, blobs blob.Store, reservations *ReservationConfig, loyalty *LoyaltyConfig) *Service {
+	return &Service{db: db, blobs: blobs, reservations: reservations, loyalty: loyalty}
 }
 
-//Manager ...
+//Manager ... PriceOverride - право продавать по ручной цене
 type Manager struct {
-	ID          int64     `json:"id"`
-	Name        string    `json:"name"`
-	Salary      int64     `json:"salary"`
-	Plan        int64     `json:"plan"`
-	BossID      int64     `json:"boss_id"`
-	Departament string    `json:"departament"`
-	Phone       string    `json:"phone"`
-	Password    string    `json:"password"`
-	IsAdmin     bool      `json:"is_admin"`
-	Created     time.Time `json:"created"`
+	ID            int64     `json:"id"`
+	Name          string    `json:"name"`
+	Salary        int64     `json:"salary"`
+	Plan          int64     `json:"plan"`
+	BossID        int64     `json:"boss_id"`
+	Departament   string    `json:"departament"`
+	Phone         string    `json:"phone"`
+	Password      string    `json:"password"`
+	IsAdmin       bool      `json:"is_admin"`
+	PriceOverride bool      `json:"price_override"`
+	Created       time.Time `json:"created"`
 }
 
-//Product ...
+//Product ... Price всегда в базовой валюте, Prices - явно заданные цены в других валютах;
+//TaxExclusive означает что налог начисляется сверху цены, иначе он уже включен в цену;
+//Attributes проверяются по схеме характеристик категории; Qty - на складе,
+//Available - на складе за вычетом действующих резервов под заказы
 type Product struct {
-	ID      int64     `json:"id"`
-	Name    string    `json:"name"`
-	Price   int       `json:"price"`
-	Qty     int       `json:"qty"`
-	Active  bool      `json:"active"`
-	Created time.Time `json:"created"`
+	ID           int64                  `json:"id"`
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description"`
+	Price        money.Money            `json:"price"`
+	Prices       []money.Money          `json:"prices"`
+	Qty          int                    `json:"qty"`
+	Available    int                    `json:"available"`
+	Category     string                 `json:"category"`
+	Attributes   map[string]interface{} `json:"attributes"`
+	Images       []*Image               `json:"images"`
+	TaxRateID    int64                  `json:"tax_rate_id"`
+	TaxExclusive bool                   `json:"tax_exclusive"`
+	Active       bool                   `json:"active"`
+	Version      int64                  `json:"version"`
+	Created      time.Time              `json:"created"`
 }
 
-//Sale ...
+//Sale ... Coupon это код купона из запроса, CouponDiscount - скидка по нему на всю продажу;
+//все суммы продажи в валюте Currency, Rate - курс этой валюты на момент продажи;
+//Returned - стоимость возвращенного товара, Refunded - сколько из неё выдано покупателю по возвратам;
+//PaymentsTotal - сколько оплачено, Balance - сколько осталось оплатить за невозвращенный товар;
+//Confirmed, Paid и Cancelled - время перехода в соответствующий статус
 type Sale struct {
-	ID         int64           `json:"id"`
-	ManagerID  int64           `json:"manager_id"`
-	CustomerID int64           `json:"customer_id"`
-	Created    time.Time       `json:"created"`
-	Positions  []*SalePosition `json:"positions"`
+	ID             int64           `json:"id"`
+	ManagerID      int64           `json:"manager_id"`
+	CustomerID     int64           `json:"customer_id"`
+	Anonymous      bool            `json:"anonymous"`
+	Currency       string          `json:"currency"`
+	Rate           float64         `json:"rate"`
+	Coupon         string          `json:"coupon"`
+	CouponDiscount int             `json:"coupon_discount"`
+	Tax            int             `json:"tax"`
+	Total          int             `json:"total"`
+	Returned       int             `json:"returned"`
+	Refunded       int             `json:"refunded"`
+	PaymentsTotal  int             `json:"payments_total"`
+	Balance        int             `json:"balance"`
+	Payments       []*Payment      `json:"payments"`
+	Taxes          []*TaxLine      `json:"taxes"`
+	Status         string          `json:"status"`
+	Source         string          `json:"source"`
+	Created        time.Time       `json:"created"`
+	Confirmed      *time.Time      `json:"confirmed"`
+	Paid           *time.Time      `json:"paid"`
+	Cancelled      *time.Time      `json:"cancelled"`
+	ReservedUntil  *time.Time      `json:"reserved_until,omitempty"`
+	Positions      []*SalePosition `json:"positions"`
 }
 
-//SalePosition ...
+//SalePosition ... Price определяет сервер по каталогу (ListPrice), клиент может только
+//попросить ручную цену OverridePrice с причиной OverrideReason;
+//Discount это сумма скидок по акциям; Net - налоговая база после всех скидок
+//(включая долю купона), к оплате по позиции Net + Tax; Returned - сколько штук уже вернули
 type SalePosition struct {
-	ID        int64     `json:"id"`
-	ProductID int64     `json:"product_id"`
-	SaleID    int64     `json:"sale_id"`
-	Price     int       `json:"price"`
-	Qty       int       `json:"qty"`
-	Created   time.Time `json:"created"`
+	ID             int64           `json:"id"`
+	ProductID      int64           `json:"product_id"`
+	ProductName    string          `json:"product_name,omitempty"`
+	SaleID         int64           `json:"sale_id"`
+	Price          money.Money     `json:"price"`
+	ListPrice      money.Money     `json:"list_price"`
+	OverridePrice  *money.Money    `json:"override_price,omitempty"`
+	OverrideReason string          `json:"override_reason,omitempty"`
+	Qty            int             `json:"qty"`
+	Returned       int             `json:"returned"`
+	Discount       int             `json:"discount"`
+	Discounts      []*SaleDiscount `json:"discounts"`
+	TaxRate        int             `json:"tax_rate"`
+	TaxExclusive   bool            `json:"tax_exclusive"`
+	Net            int             `json:"net"`
+	Tax            int             `json:"tax"`
+	Created        time.Time       `json:"created"`
 }
 
-//Customer ...
+//Customer ... Credit - баланс покупателя в базовой валюте
 type Customer struct {
 	ID      int64     `json:"id"`
 	Name    string    `json:"name"`
 	Phone   string    `json:"phone"`
 	Active  bool      `json:"active"`
+	Credit  int       `json:"credit"`
+	Version int64     `json:"version"`
 	Created time.Time `json:"created"`
 }
 
@@ -109,8 +168,8 @@ func (s *Service) Create(ctx context.Context, item *Manager) (string, error) {
 	var token string
 	var id int64
 
-	sqlStmt := `insert into managers(name,phone,is_admin) values ($1,$2,$3) on conflict (phone) do nothing returning id;`
-	err := s.db.QueryRow(ctx, sqlStmt, item.Name, item.Phone, item.IsAdmin).Scan(&id)
+	sqlStmt := `insert into managers(name,phone,is_admin,price_override) values ($1,$2,$3,$4) on conflict (phone) do nothing returning id;`
+	err := s.db.QueryRow(ctx, sqlStmt, item.Name, item.Phone, item.IsAdmin, item.PriceOverride).Scan(&id)
 	if err != nil {
 		log.Print(err)
 		return "", types.ErrInternal
@@ -160,94 +219,404 @@ func (s *Service) Token(ctx context.Context, phone, password string) (token stri
 	return token, nil
 }
 
-//SaveProduct ...
+//SaveProduct ... для существующего товара product.Version должен совпадать с версией в базе
 func (s *Service) SaveProduct(ctx context.Context, product *Product) (*Product, error) {
 
-	var err error
+	currency, err := money.Normalize(product.Price.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if currency != money.Base {
+		return nil, types.ErrCurrencyMismatch
+	}
+	product.Price.Currency = currency
+	for i := range product.Prices {
+		product.Prices[i].Currency, err = money.Normalize(product.Prices[i].Currency)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if product.Attributes == nil {
+		product.Attributes = map[string]interface{}{}
+	}
+	if err = s.validateAttributes(ctx, product.Category, product.Attributes); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
 
 	if product.ID == 0 {
-		sqlstmt := `insert into products(name,qty,price) values ($1,$2,$3) returning id,name,qty,price,active,created;`
-		err = s.db.QueryRow(ctx, sqlstmt, product.Name, product.Qty, product.Price).
-			Scan(&product.ID, &product.Name, &product.Qty, &product.Price, &product.Active, &product.Created)
+		sqlstmt := `insert into products(name,qty,price,category,tax_rate_id,tax_exclusive,description,attributes) values ($1,$2,$3,$4,nullif($5,0),$6,$7,$8)
+		returning id,name,qty,price,category,coalesce(tax_rate_id,0),tax_exclusive,description,attributes,active,version,created;`
+		err = tx.QueryRow(ctx, sqlstmt, product.Name, product.Qty, product.Price.Amount, product.Category, product.TaxRateID, product.TaxExclusive, product.Description, product.Attributes).
+			Scan(&product.ID, &product.Name, &product.Qty, &product.Price.Amount, &product.Category, &product.TaxRateID, &product.TaxExclusive, &product.Description, &product.Attributes, &product.Active, &product.Version, &product.Created)
 	} else {
-		sqlstmt := `update  products set  name=$1, qty=$2,price=$3  where id = $4 returning id,name,qty,price,active,created;`
-		err = s.db.QueryRow(ctx, sqlstmt, product.Name, product.Qty, product.Price, product.ID).
-			Scan(&product.ID, &product.Name, &product.Qty, &product.Price, &product.Active, &product.Created)
+		sqlstmt := `update  products set  name=$1, qty=$2,price=$3, category=$6, tax_rate_id=nullif($7,0), tax_exclusive=$8, description=$9, attributes=$10, version=version+1  where id = $4 and version = $5
+		returning id,name,qty,price,category,coalesce(tax_rate_id,0),tax_exclusive,description,attributes,active,version,created;`
+		err = tx.QueryRow(ctx, sqlstmt, product.Name, product.Qty, product.Price.Amount, product.ID, product.Version, product.Category, product.TaxRateID, product.TaxExclusive, product.Description, product.Attributes).
+			Scan(&product.ID, &product.Name, &product.Qty, &product.Price.Amount, &product.Category, &product.TaxRateID, &product.TaxExclusive, &product.Description, &product.Attributes, &product.Active, &product.Version, &product.Created)
+		if err == pgx.ErrNoRows {
+			return nil, s.versionConflict(ctx, "products", product.ID)
+		}
+	}
+	if err == nil {
+		err = savePrices(ctx, tx, product)
+	}
+	var removed []string
+	if err == nil {
+		removed, err = saveImages(ctx, tx, product)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
 	}
 
 	if err != nil {
 		log.Print(err)
 		return nil, types.ErrInternal
 	}
+	s.deleteBlobs(ctx, removed...)
 	return product, nil
 }
 
-//MakeSalePosition ...
-func (s *Service) MakeSalePosition(ctx context.Context, position *SalePosition) bool {
-	active := false
-	qty := 0
-	if err := s.db.QueryRow(ctx, `select qty,active from products where id = $1`, position.ProductID).
-		Scan(&qty, &active); err != nil {
-		return false
+//ProductByID ...
+func (s *Service) ProductByID(ctx context.Context, id int64) (*Product, error) {
+	item := &Product{Price: money.Money{Currency: money.Base}}
+	sqlstmt := `select id, name, price, qty, qty - ` + fmt.Sprintf(reservedQty, 2) + `, category, coalesce(tax_rate_id,0), tax_exclusive, description, attributes, active, version, created
+	from products p where id = $1`
+	err := s.db.QueryRow(ctx, sqlstmt, id, 0).
+		Scan(&item.ID, &item.Name, &item.Price.Amount, &item.Qty, &item.Available, &item.Category, &item.TaxRateID, &item.TaxExclusive, &item.Description, &item.Attributes, &item.Active, &item.Version, &item.Created)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
 	}
-	if qty < position.Qty || !active {
-		return false
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
 	}
-	if _, err := s.db.Exec(ctx, `update products set qty = $1 where id = $2`, qty-position.Qty, position.ProductID); err != nil {
+
+	prices, err := s.productsPrices(ctx, []int64{item.ID})
+	if err != nil {
 		log.Print(err)
-		return false
+		return nil, types.ErrInternal
+	}
+	item.Prices = prices[item.ID]
+
+	images, err := s.productsImages(ctx, []int64{item.ID})
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
 	}
-	return true
+	item.Images = images[item.ID]
+
+	return item, nil
 }
 
-//MakeSale ...
+//versionConflict ... вызывается когда update по id и версии не затронул ни одной строки:
+//либо записи нет (ErrNotFound), либо её уже кто-то изменил (*types.ConflictError)
+func (s *Service) versionConflict(ctx context.Context, table string, id int64) error {
+	var version int64
+	err := s.db.QueryRow(ctx, `select version from `+table+` where id = $1`, id).Scan(&version)
+	if err == pgx.ErrNoRows {
+		return types.ErrNotFound
+	}
+	if err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	return &types.ConflictError{Entity: table, ID: id, Version: version}
+}
+
+//querier ... общие методы пула и транзакции, чтобы одни и те же запросы работали и там и там
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+//takeStock ... списывает остатки по позициям условным update (без чтения и записи по отдельности),
+//строки товаров блокируются по порядку id, чтобы параллельные продажи не ловили deadlock;
+//товар, зарезервированный под другие продажи, списать нельзя
+func takeStock(ctx context.Context, tx pgx.Tx, saleID int64, positions []*SalePosition) error {
+	sorted := make([]*SalePosition, len(positions))
+	copy(sorted, positions)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].ProductID < sorted[j].ProductID })
+
+	for _, position := range sorted {
+		sqlstmt := `update products p set qty = qty - $1, version = version + 1
+		where id = $2 and active and qty - ` + fmt.Sprintf(reservedQty, 3) + ` >= $1`
+		tag, err := tx.Exec(ctx, sqlstmt, position.Qty, position.ProductID, saleID)
+		if err != nil {
+			log.Print(err)
+			return types.ErrInternal
+		}
+		if tag.RowsAffected() == 1 {
+			continue
+		}
+
+		active := false
+		err = tx.QueryRow(ctx, `select active from products where id = $1`, position.ProductID).Scan(&active)
+		if err == pgx.ErrNoRows || err == nil && !active {
+			return types.ErrInvalidPosition
+		}
+		if err != nil {
+			log.Print(err)
+			return types.ErrInternal
+		}
+		return types.ErrOutOfStock
+	}
+	return nil
+}
+
+//MakeSale ... вся продажа проводится одной транзакцией: при любой ошибке (в т.ч. в одной из позиций)
+//не сохраняется ни продажа, ни списание остатков, ни погашение купона;
+//без статуса продажа сразу подтверждается, черновик (SaleDraft) склад и купон не трогает
 func (s *Service) MakeSale(ctx context.Context, sale *Sale) (*Sale, error) {
+	if sale.Status == "" {
+		sale.Status = SaleConfirmed
+	}
+	if sale.Status != SaleDraft && sale.Status != SaleConfirmed {
+		return nil, types.ErrInvalidStatus
+	}
+	sale.Source = SaleSourceManager
+	if err := s.prepareSale(ctx, sale); err != nil {
+		return nil, err
+	}
 
-	positionsSQLstmt := "insert into sales_positions (sale_id,product_id,qty,price) values "
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
 
-	sqlstmt := `insert into sales(manager_id,customer_id) values ($1,$2) returning id, created;`
+	sqlstmt := `
+	insert into sales(manager_id,customer_id,currency,rate,coupon,status,confirmed)
+	values ($1,nullif($2,0),$3,$4,$5,$6,case when $6 = 'confirmed' then current_timestamp end)
+	returning id, created, confirmed`
+	err = tx.QueryRow(ctx, sqlstmt, sale.ManagerID, sale.CustomerID, sale.Currency, sale.Rate, sale.Coupon, sale.Status).
+		Scan(&sale.ID, &sale.Created, &sale.Confirmed)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
 
-	err := s.db.QueryRow(ctx, sqlstmt, sale.ManagerID, sale.CustomerID).Scan(&sale.ID, &sale.Created)
+	if sale.Status == SaleConfirmed {
+		err = s.confirmSale(ctx, tx, sale)
+	} else {
+		err = priceSale(ctx, tx, sale, nil)
+	}
 	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
 		log.Print(err)
 		return nil, types.ErrInternal
 	}
+
+	return sale, nil
+}
+
+//prepareSale ... проверки продажи до транзакции: позиции, валюта с текущим курсом и ручные цены
+func (s *Service) prepareSale(ctx context.Context, sale *Sale) error {
+	if len(sale.Positions) == 0 {
+		return types.ErrInvalidPosition
+	}
+
+	currency, err := money.Normalize(sale.Currency)
+	if err != nil {
+		return err
+	}
+	sale.Currency = currency
+	sale.Rate, err = s.exchangeRate(ctx, sale.Currency)
+	if err != nil {
+		return err
+	}
+	sale.Coupon = strings.ToUpper(strings.TrimSpace(sale.Coupon))
 	for _, position := range sale.Positions {
-		if !s.MakeSalePosition(ctx, position) {
-			log.Print("Invalid position")
-			return nil, types.ErrInternal
+		if position.Qty <= 0 {
+			return types.ErrInvalidPosition
 		}
-		positionsSQLstmt += "(" + strconv.FormatInt(sale.ID, 10) + "," + strconv.FormatInt(position.ProductID, 10) + "," + strconv.Itoa(position.Price) + "," + strconv.Itoa(position.Qty) + "),"
 	}
+	if err = s.checkCustomer(ctx, sale); err != nil {
+		return err
+	}
+	return s.checkOverrides(ctx, sale)
+}
 
-	positionsSQLstmt = positionsSQLstmt[0 : len(positionsSQLstmt)-1]
+//checkCustomer ... продажа либо на существующего активного покупателя, либо явно анонимная
+//(покупатель без карточки, customer_id не указывается)
+func (s *Service) checkCustomer(ctx context.Context, sale *Sale) error {
+	if sale.Anonymous {
+		if sale.CustomerID != 0 {
+			return types.ErrAnonymousCustomer
+		}
+		return nil
+	}
+	if sale.CustomerID == 0 {
+		return types.ErrCustomerRequired
+	}
 
-	log.Print(positionsSQLstmt)
-	_, err = s.db.Exec(ctx, positionsSQLstmt)
+	active := false
+	err := s.db.QueryRow(ctx, `select active from customers where id = $1`, sale.CustomerID).Scan(&active)
+	if err == pgx.ErrNoRows {
+		return types.ErrCustomerNotFound
+	}
 	if err != nil {
 		log.Print(err)
-		return nil, types.ErrInternal
+		return types.ErrInternal
+	}
+	if !active {
+		return types.ErrCustomerInactive
 	}
+	return nil
+}
 
-	return sale, nil
+//confirmSale ... списывает остатки, гасит купон, проводит позиции уже сохраненной продажи
+//и начисляет покупателю баллы
+func (s *Service) confirmSale(ctx context.Context, tx pgx.Tx, sale *Sale) error {
+	if err := takeStock(ctx, tx, sale.ID, sale.Positions); err != nil {
+		return err
+	}
+	//резерв черновика превратился в списание
+	if err := releaseReservations(ctx, tx, sale.ID); err != nil {
+		return err
+	}
+
+	var coupon *Coupon
+	var err error
+	if sale.Coupon != "" {
+		coupon, err = redeemCoupon(ctx, tx, sale.Coupon, sale.CustomerID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = priceSale(ctx, tx, sale, coupon); err != nil {
+		return err
+	}
+
+	if coupon != nil {
+		_, err = tx.Exec(ctx, `insert into coupons_redemptions (coupon_id,sale_id,customer_id,amount) values ($1,$2,nullif($3,0),$4)`,
+			coupon.ID, sale.ID, sale.CustomerID, sale.CouponDiscount)
+		if err != nil {
+			log.Print(err)
+			return types.ErrInternal
+		}
+	}
+	return s.earnPoints(ctx, tx, sale)
 }
 
-//GetSales ...
+//priceSale ... считает цены, скидки и налоги позиций и сохраняет их; coupon == nil для черновика
+func priceSale(ctx context.Context, tx pgx.Tx, sale *Sale, coupon *Coupon) error {
+	amounts := make([]int, len(sale.Positions))
+	total := 0
+	for i, position := range sale.Positions {
+		err := resolvePrice(ctx, tx, position, sale.Currency, sale.Rate)
+		if err == pgx.ErrNoRows {
+			return types.ErrInvalidPosition
+		}
+		if err != nil {
+			log.Print(err)
+			return types.ErrInternal
+		}
+		//скидки считаются на сервере по действующим акциям
+		if err := applyPromotions(ctx, tx, position, sale.Rate); err != nil {
+			log.Print(err)
+			return types.ErrInternal
+		}
+		if err := applyTaxRate(ctx, tx, position); err != nil {
+			log.Print(err)
+			return types.ErrInternal
+		}
+		amounts[i] = position.Price.Amount*position.Qty - position.Discount
+		total += amounts[i]
+	}
+
+	//скидка по купону уменьшает налоговую базу, поэтому делим её между позициями до расчета налога
+	sale.CouponDiscount = 0
+	if coupon != nil {
+		sale.CouponDiscount = coupon.Discount(total, sale.Currency, sale.Rate)
+	}
+	shares := allocate(sale.CouponDiscount, amounts)
+
+	sale.Tax, sale.Total = 0, 0
+	for i, position := range sale.Positions {
+		position.Net, position.Tax = calcTax(amounts[i]-shares[i], position.TaxRate, position.TaxExclusive)
+		sale.Tax += position.Tax
+		sale.Total += position.Net + position.Tax
+
+		position.SaleID = sale.ID
+		//для аудита ручной цены сохраняем каталожную цену, причину и кто поменял
+		var overrideBy *int64
+		if position.OverridePrice != nil {
+			overrideBy = &sale.ManagerID
+		}
+		err := tx.QueryRow(ctx, `insert into sales_positions (sale_id,product_id,qty,price,discount,tax_rate,tax_exclusive,net,tax,list_price,override_reason,override_by)
+		values ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12) returning id, created`,
+			position.SaleID, position.ProductID, position.Qty, position.Price.Amount, position.Discount,
+			position.TaxRate, position.TaxExclusive, position.Net, position.Tax,
+			position.ListPrice.Amount, position.OverrideReason, overrideBy).Scan(&position.ID, &position.Created)
+		if err != nil {
+			log.Print(err)
+			return types.ErrInternal
+		}
+
+		for _, discount := range position.Discounts {
+			_, err = tx.Exec(ctx, `insert into sales_positions_discounts (position_id,promotion_id,amount) values ($1,$2,$3)`,
+				position.ID, discount.PromotionID, discount.Amount)
+			if err != nil {
+				log.Print(err)
+				return types.ErrInternal
+			}
+		}
+	}
+	sale.Taxes = taxBreakdown(sale.Positions)
+	sale.Payments = make([]*Payment, 0)
+	sale.PaymentsTotal, sale.Balance = 0, sale.Total
+	return nil
+}
+
+//GetSales ... сумма продаж менеджера в базовой валюте (по курсу на момент каждой продажи)
 func (s *Service) GetSales(ctx context.Context, id int64) (sum int, err error) {
 
 	sqlstmt := `
-	select coalesce(sum(sp.qty * sp.price),0) total
-	from managers m
-	left join sales s on s.manager_id= $1
-	left join sales_positions sp on sp.sale_id = s.id
-	group by m.id
-	limit 1`
-
-	err = s.db.QueryRow(ctx, sqlstmt, id).Scan(&sum)
+	with totals as (
+		select s.currency, s.rate,
+		coalesce((select sum(sp.qty * sp.price - sp.discount) from sales_positions sp where sp.sale_id = s.id),0) -
+		coalesce((select sum(r.amount) from coupons_redemptions r where r.sale_id = s.id),0) -
+		coalesce((select sum(rp.net + case when sp.tax_exclusive then 0 else rp.tax end)
+			from returns_positions rp
+			join sales_positions sp on sp.id = rp.position_id
+			where sp.sale_id = s.id),0) amount
+		from sales s
+		where s.manager_id = $1 and s.status in ('confirmed', 'paid')
+	)
+	select currency, rate, sum(amount) from totals group by currency, rate`
+
+	rows, err := s.db.Query(ctx, sqlstmt, id)
 	if err != nil {
 		log.Print(err)
 		return 0, types.ErrInternal
 	}
+	defer rows.Close()
+
+	for rows.Next() {
+		total := money.Money{}
+		var rate float64
+		if err = rows.Scan(&total.Currency, &rate, &total.Amount); err != nil {
+			log.Print(err)
+			return 0, types.ErrInternal
+		}
+		sum += money.ToBase(total, rate)
+	}
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return 0, types.ErrInternal
+	}
 	return sum, nil
 }
 
@@ -256,8 +625,9 @@ func (s *Service) Products(ctx context.Context) ([]*Product, error) {
 
 	items := make([]*Product, 0)
 
-	sqlstmt := `select id, name, price, qty from products where active = true order by id limit 500`
-	rows, err := s.db.Query(ctx, sqlstmt)
+	sqlstmt := `select id, name, price, qty, qty - ` + fmt.Sprintf(reservedQty, 1) + `, category, coalesce(tax_rate_id,0), tax_exclusive, version
+	from products p where active = true order by id limit 500`
+	rows, err := s.db.Query(ctx, sqlstmt, 0)
 
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -267,14 +637,32 @@ func (s *Service) Products(ctx context.Context) ([]*Product, error) {
 	}
 	defer rows.Close()
 
+	ids := make([]int64, 0)
 	for rows.Next() {
-		item := &Product{}
-		err = rows.Scan(&item.ID, &item.Name, &item.Price, &item.Qty)
+		item := &Product{Price: money.Money{Currency: money.Base}}
+		err = rows.Scan(&item.ID, &item.Name, &item.Price.Amount, &item.Qty, &item.Available, &item.Category, &item.TaxRateID, &item.TaxExclusive, &item.Version)
 		if err != nil {
 			log.Print(err)
 			return nil, err
 		}
 		items = append(items, item)
+		ids = append(ids, item.ID)
+	}
+	rows.Close()
+
+	prices, err := s.productsPrices(ctx, ids)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	images, err := s.productsImages(ctx, ids)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	for _, item := range items {
+		item.Prices = prices[item.ID]
+		item.Images = images[item.ID]
 	}
 
 	return items, nil
@@ -291,14 +679,52 @@ func (s *Service) RemoveProductByID(ctx context.Context, id int64) (err error) {
 	return nil
 }
 
-//RemoveCustomerByID ...
+//RemoveCustomerByID ... корзина и токены покупателя удаляются вместе с ним
 func (s *Service) RemoveCustomerByID(ctx context.Context, id int64) (err error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	defer tx.Rollback(ctx)
 
-	_, err = s.db.Exec(ctx, `DELETE from customers where id = $1`, id)
+	//блокировка не дает параллельной продаже сослаться на покупателя между проверкой и удалением
+	_, err = tx.Exec(ctx, `select id from customers where id = $1 for update`, id)
 	if err != nil {
 		log.Print(err)
 		return types.ErrInternal
 	}
+
+	//покупателя с историей (продажи, баллы, погашенные купоны) удалить нельзя, его можно только деактивировать
+	used := false
+	sqlstmt := `select exists(select 1 from sales where customer_id = $1)
+	or exists(select 1 from loyalty_ledger where customer_id = $1)
+	or exists(select 1 from coupons_redemptions where customer_id = $1)`
+	err = tx.QueryRow(ctx, sqlstmt, id).Scan(&used)
+	if err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
+	if used {
+		return types.ErrCustomerInUse
+	}
+
+	for _, sqlstmt := range []string{
+		`delete from carts_items where customer_id = $1`,
+		`delete from carts where customer_id = $1`,
+		`delete from customers_tokens where customer_id = $1`,
+		`DELETE from customers where id = $1`,
+	} {
+		if _, err = tx.Exec(ctx, sqlstmt, id); err != nil {
+			log.Print(err)
+			return types.ErrInternal
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Print(err)
+		return types.ErrInternal
+	}
 	return nil
 }
 
@@ -306,7 +732,7 @@ func (s *Service) RemoveCustomerByID(ctx context.Context, id int64) (err error)
 func (s *Service) Customers(ctx context.Context) ([]*Customer, error) {
 
 	items := make([]*Customer, 0)
-	sqlstmt := `select id, name, phone, active, created from customers where active = true order by id limit 500`
+	sqlstmt := `select id, name, phone, active, credit, version, created from customers where active = true order by id limit 500`
 	rows, err := s.db.Query(ctx, sqlstmt)
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -318,7 +744,7 @@ func (s *Service) Customers(ctx context.Context) ([]*Customer, error) {
 
 	for rows.Next() {
 		item := &Customer{}
-		err = rows.Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Created)
+		err = rows.Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Credit, &item.Version, &item.Created)
 		if err != nil {
 			log.Print(err)
 			return nil, err
@@ -329,13 +755,33 @@ func (s *Service) Customers(ctx context.Context) ([]*Customer, error) {
 	return items, nil
 }
 
-//ChangeCustomer ...
+//CustomerByID ...
+func (s *Service) CustomerByID(ctx context.Context, id int64) (*Customer, error) {
+	item := &Customer{}
+	sqlstmt := `select id, name, phone, active, credit, version, created from customers where id = $1`
+	err := s.db.QueryRow(ctx, sqlstmt, id).
+		Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Credit, &item.Version, &item.Created)
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
+
+//ChangeCustomer ... customer.Version должен совпадать с версией в базе
 func (s *Service) ChangeCustomer(ctx context.Context, customer *Customer) (*Customer, error) {
 
-	sqlstmt := `update customers set name = $2, phone = $3, active = $4  where id = $1 returning name,phone,active`
+	sqlstmt := `update customers set name = $2, phone = $3, active = $4, version = version + 1  where id = $1 and version = $5 returning name,phone,active,credit,version,created`
 
-	if err := s.db.QueryRow(ctx, sqlstmt, customer.ID, customer.Name, customer.Phone, customer.Active).
-		Scan(&customer.Name, &customer.Phone, &customer.Active); err != nil {
+	err := s.db.QueryRow(ctx, sqlstmt, customer.ID, customer.Name, customer.Phone, customer.Active, customer.Version).
+		Scan(&customer.Name, &customer.Phone, &customer.Active, &customer.Credit, &customer.Version, &customer.Created)
+	if err == pgx.ErrNoRows {
+		return nil, s.versionConflict(ctx, "customers", customer.ID)
+	}
+	if err != nil {
 		log.Print(err)
 		return nil, types.ErrInternal
 	}
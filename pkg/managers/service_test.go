@@ -0,0 +1,175 @@
+package managers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+//testService ... сервис на тестовой базе (TEST_DATABASE_URL, схема из docker-entrypoint-initdb.d),
+//без базы тесты пропускаются
+func testService(t *testing.T) *Service {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	pool, err := pgxpool.Connect(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	return NewService(pool, nil,
+		&ReservationConfig{TTL: time.Hour, SweepInterval: time.Minute},
+		&LoyaltyConfig{ExpiryDays: 365, SweepInterval: time.Hour})
+}
+
+//uniquePhone ... телефоны уникальны в схеме, поэтому фикстуры каждого теста получают свой
+func uniquePhone() string {
+	return fmt.Sprintf("+992%d", time.Now().UnixNano())
+}
+
+func testManager(t *testing.T, s *Service) int64 {
+	t.Helper()
+	var id int64
+	err := s.db.QueryRow(context.Background(),
+		`insert into managers (name,phone,is_admin) values ('test',$1,false) returning id`, uniquePhone()).Scan(&id)
+	if err != nil {
+		t.Fatalf("insert manager: %v", err)
+	}
+	return id
+}
+
+func testCustomer(t *testing.T, s *Service) int64 {
+	t.Helper()
+	var id int64
+	err := s.db.QueryRow(context.Background(),
+		`insert into customers (name,phone,password) values ('test',$1,'') returning id`, uniquePhone()).Scan(&id)
+	if err != nil {
+		t.Fatalf("insert customer: %v", err)
+	}
+	return id
+}
+
+func testProduct(t *testing.T, s *Service, price, qty int) int64 {
+	t.Helper()
+	var id int64
+	err := s.db.QueryRow(context.Background(),
+		`insert into products (name,price,qty) values ('test',$1,$2) returning id`, price, qty).Scan(&id)
+	if err != nil {
+		t.Fatalf("insert product: %v", err)
+	}
+	return id
+}
+
+func productQty(t *testing.T, s *Service, id int64) int {
+	t.Helper()
+	qty := 0
+	if err := s.db.QueryRow(context.Background(), `select qty from products where id = $1`, id).Scan(&qty); err != nil {
+		t.Fatalf("select product: %v", err)
+	}
+	return qty
+}
+
+func TestMakeSaleConcurrentNoOversell(t *testing.T) {
+	s := testService(t)
+	ctx := context.Background()
+	const stock, buyers = 10, 30
+
+	managerID := testManager(t, s)
+	customerID := testCustomer(t, s)
+	productID := testProduct(t, s, 100, stock)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	sold := 0
+	for i := 0; i < buyers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sale := &Sale{
+				ManagerID:  managerID,
+				CustomerID: customerID,
+				Positions:  []*SalePosition{{ProductID: productID, Qty: 1}},
+			}
+			_, err := s.MakeSale(ctx, sale)
+			if err == types.ErrOutOfStock {
+				return
+			}
+			if err != nil {
+				t.Errorf("MakeSale: %v", err)
+				return
+			}
+			mu.Lock()
+			sold++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	qty := productQty(t, s, productID)
+	if qty < 0 {
+		t.Fatalf("qty = %d, oversold", qty)
+	}
+	if sold+qty != stock {
+		t.Errorf("sold %d + left %d != stock %d", sold, qty, stock)
+	}
+	if sold != stock {
+		t.Errorf("sold = %d, want all %d in stock", sold, stock)
+	}
+
+	positions := 0
+	err := s.db.QueryRow(ctx, `select coalesce(sum(sp.qty),0) from sales_positions sp join sales s on s.id = sp.sale_id
+	where s.manager_id = $1`, managerID).Scan(&positions)
+	if err != nil {
+		t.Fatalf("select positions: %v", err)
+	}
+	if positions != sold {
+		t.Errorf("positions qty = %d, want %d", positions, sold)
+	}
+}
+
+func TestMakeSaleBadPositionRollsBack(t *testing.T) {
+	s := testService(t)
+	ctx := context.Background()
+
+	managerID := testManager(t, s)
+	customerID := testCustomer(t, s)
+	productID := testProduct(t, s, 100, 5)
+
+	sale := &Sale{
+		ManagerID:  managerID,
+		CustomerID: customerID,
+		Positions: []*SalePosition{
+			{ProductID: productID, Qty: 2},
+			{ProductID: -1, Qty: 1},
+		},
+	}
+	if _, err := s.MakeSale(ctx, sale); err != types.ErrInvalidPosition {
+		t.Fatalf("MakeSale err = %v, want %v", err, types.ErrInvalidPosition)
+	}
+
+	sales, positions := 0, 0
+	err := s.db.QueryRow(ctx, `select count(*) from sales where manager_id = $1`, managerID).Scan(&sales)
+	if err != nil {
+		t.Fatalf("select sales: %v", err)
+	}
+	err = s.db.QueryRow(ctx, `select count(*) from sales_positions where product_id = $1`, productID).Scan(&positions)
+	if err != nil {
+		t.Fatalf("select positions: %v", err)
+	}
+	if sales != 0 || positions != 0 {
+		t.Errorf("sales = %d, positions = %d, want nothing saved", sales, positions)
+	}
+	if qty := productQty(t, s, productID); qty != 5 {
+		t.Errorf("qty = %d, want untouched 5", qty)
+	}
+}
@@ -0,0 +1,224 @@
+package managers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/money"
+	"github.com/FaranushKarimov/crud/pkg/types"
+	"github.com/jackc/pgx/v4"
+)
+
+//rateBase ... ставки храним в сотых долях процента: 2000 это 20%
+const rateBase = 10000
+
+//TaxRate ...
+type TaxRate struct {
+	ID      int64     `json:"id"`
+	Name    string    `json:"name"`
+	Rate    int       `json:"rate"`
+	Active  bool      `json:"active"`
+	Created time.Time `json:"created"`
+}
+
+//CategoryTax ... ставка по умолчанию для всех товаров категории, TaxRateID = 0 снимает привязку
+type CategoryTax struct {
+	Category  string `json:"category"`
+	TaxRateID int64  `json:"tax_rate_id"`
+}
+
+//TaxLine ... строка налоговой расшифровки: сумма без налога и налог по одной ставке
+type TaxLine struct {
+	Rate  int `json:"rate"`
+	Net   int `json:"net"`
+	Tax   int `json:"tax"`
+	Gross int `json:"gross"`
+}
+
+//calcTax ... делит сумму на базу и налог; при exclusive налог начисляется сверху
+func calcTax(amount, rate int, exclusive bool) (net, tax int) {
+	if exclusive {
+		return amount, divRound(amount*rate, rateBase)
+	}
+	tax = divRound(amount*rate, rateBase+rate)
+	return amount - tax, tax
+}
+
+//allocate ... распределяет amount пропорционально весам, остаток от округления уходит в последнюю ненулевую долю
+func allocate(amount int, weights []int) []int {
+	shares := make([]int, len(weights))
+	total := 0
+	for _, weight := range weights {
+		total += weight
+	}
+	if total == 0 || amount == 0 {
+		return shares
+	}
+
+	rest, last := amount, -1
+	for i, weight := range weights {
+		shares[i] = amount * weight / total
+		rest -= shares[i]
+		if weight > 0 {
+			last = i
+		}
+	}
+	shares[last] += rest
+	return shares
+}
+
+func divRound(a, b int) int {
+	return (a + b/2) / b
+}
+
+//taxBreakdown ... сворачивает позиции продажи по ставкам
+func taxBreakdown(positions []*SalePosition) []*TaxLine {
+	lines := make([]*TaxLine, 0)
+	byRate := make(map[int]*TaxLine)
+	for _, position := range positions {
+		line, ok := byRate[position.TaxRate]
+		if !ok {
+			line = &TaxLine{Rate: position.TaxRate}
+			byRate[position.TaxRate] = line
+			lines = append(lines, line)
+		}
+		line.Net += position.Net
+		line.Tax += position.Tax
+		line.Gross += position.Net + position.Tax
+	}
+	return lines
+}
+
+//SaveTaxRate ...
+func (s *Service) SaveTaxRate(ctx context.Context, item *TaxRate) (*TaxRate, error) {
+	if item.Name == "" || item.Rate < 0 || item.Rate >= rateBase {
+		return nil, types.ErrInvalidTaxRate
+	}
+
+	var err error
+	if item.ID == 0 {
+		err = s.db.QueryRow(ctx, `insert into tax_rates(name,rate) values ($1,$2) returning id,active,created`,
+			item.Name, item.Rate).Scan(&item.ID, &item.Active, &item.Created)
+	} else {
+		err = s.db.QueryRow(ctx, `update tax_rates set name=$2, rate=$3, active=$4 where id = $1 returning created`,
+			item.ID, item.Name, item.Rate, item.Active).Scan(&item.Created)
+	}
+	if err == pgx.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
+
+//TaxRates ...
+func (s *Service) TaxRates(ctx context.Context) ([]*TaxRate, error) {
+	items := make([]*TaxRate, 0)
+
+	rows, err := s.db.Query(ctx, `select id,name,rate,active,created from tax_rates order by id`)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &TaxRate{}
+		err = rows.Scan(&item.ID, &item.Name, &item.Rate, &item.Active, &item.Created)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+//SetCategoryTax ...
+func (s *Service) SetCategoryTax(ctx context.Context, item *CategoryTax) (*CategoryTax, error) {
+	if item.Category == "" {
+		return nil, types.ErrInvalidTaxRate
+	}
+
+	var err error
+	if item.TaxRateID == 0 {
+		_, err = s.db.Exec(ctx, `delete from categories_taxes where category = $1`, item.Category)
+	} else {
+		_, err = s.db.Exec(ctx, `insert into categories_taxes(category,tax_rate_id) values ($1,$2)
+		on conflict (category) do update set tax_rate_id = excluded.tax_rate_id`, item.Category, item.TaxRateID)
+	}
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	return item, nil
+}
+
+//TaxesReport ... налоговая расшифровка продаж за период [from, to) в базовой валюте за вычетом возвратов;
+//суммы в валютах продаж переводим по курсу каждой продажи
+func (s *Service) TaxesReport(ctx context.Context, from, to time.Time) ([]*TaxLine, error) {
+	items := make([]*TaxLine, 0)
+	byRate := make(map[int]*TaxLine)
+
+	sqlstmt := `
+	select sp.tax_rate, s.currency, s.rate,
+	coalesce(sum(sp.net - coalesce(rp.net, 0)),0), coalesce(sum(sp.tax - coalesce(rp.tax, 0)),0)
+	from sales s
+	join sales_positions sp on sp.sale_id = s.id
+	left join (
+		select position_id, sum(net) net, sum(tax) tax from returns_positions group by position_id
+	) rp on rp.position_id = sp.id
+	where s.status in ('confirmed', 'paid') and s.confirmed >= $1 and s.confirmed < $2
+	group by sp.tax_rate, s.currency, s.rate
+	order by sp.tax_rate`
+	rows, err := s.db.Query(ctx, sqlstmt, from, to)
+	if err != nil {
+		log.Print(err)
+		return nil, types.ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var taxRate int
+		var rate float64
+		net, tax := money.Money{}, money.Money{}
+		err = rows.Scan(&taxRate, &net.Currency, &rate, &net.Amount, &tax.Amount)
+		if err != nil {
+			log.Print(err)
+			return nil, types.ErrInternal
+		}
+		tax.Currency = net.Currency
+
+		item, ok := byRate[taxRate]
+		if !ok {
+			item = &TaxLine{Rate: taxRate}
+			byRate[taxRate] = item
+			items = append(items, item)
+		}
+		item.Net += money.ToBase(net, rate)
+		item.Tax += money.ToBase(tax, rate)
+		item.Gross = item.Net + item.Tax
+	}
+	if rows.Err() != nil {
+		log.Print(rows.Err())
+		return nil, types.ErrInternal
+	}
+
+	return items, nil
+}
+
+//applyTaxRate ... ставка товара, если не задана - ставка его категории, иначе 0
+func applyTaxRate(ctx context.Context, q querier, position *SalePosition) error {
+	sqlstmt := `
+	select coalesce(r.rate, cr.rate, 0), p.tax_exclusive
+	from products p
+	left join tax_rates r on r.id = p.tax_rate_id and r.active
+	left join categories_taxes ct on ct.category = p.category
+	left join tax_rates cr on cr.id = ct.tax_rate_id and cr.active
+	where p.id = $1`
+	return q.QueryRow(ctx, sqlstmt, position.ProductID).Scan(&position.TaxRate, &position.TaxExclusive)
+}
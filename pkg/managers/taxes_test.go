@@ -0,0 +1,67 @@
+package managers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/money"
+)
+
+func TestTaxesReportBaseCurrencyNetOfReturns(t *testing.T) {
+	s := testService(t)
+	ctx := context.Background()
+	const taxRate = 1111
+	from := time.Now().Add(-time.Minute)
+
+	managerID := testManager(t, s)
+	productID := testProduct(t, s, 1000, 10)
+	var taxRateID int64
+	err := s.db.QueryRow(ctx, `insert into tax_rates (name,rate) values ('test',$1) returning id`, taxRate).Scan(&taxRateID)
+	if err != nil {
+		t.Fatalf("insert tax rate: %v", err)
+	}
+	if _, err = s.db.Exec(ctx, `update products set tax_rate_id = $2 where id = $1`, productID, taxRateID); err != nil {
+		t.Fatalf("update product: %v", err)
+	}
+	if _, err = s.db.Exec(ctx, `insert into exchange_rates (currency,rate) values ('USD',10)`); err != nil {
+		t.Fatalf("insert exchange rate: %v", err)
+	}
+
+	local, err := s.MakeSale(ctx, &Sale{ManagerID: managerID, Anonymous: true,
+		Positions: []*SalePosition{{ProductID: productID, Qty: 2}}})
+	if err != nil {
+		t.Fatalf("MakeSale TJS: %v", err)
+	}
+	_, err = s.MakeSale(ctx, &Sale{ManagerID: managerID, Anonymous: true, Currency: "USD",
+		Positions: []*SalePosition{{ProductID: productID, Qty: 1}}})
+	if err != nil {
+		t.Fatalf("MakeSale USD: %v", err)
+	}
+	_, err = s.MakeReturn(ctx, &Return{SaleID: local.ID, ManagerID: managerID,
+		Positions: []*ReturnPosition{{PositionID: local.Positions[0].ID, Qty: 1}}})
+	if err != nil {
+		t.Fatalf("MakeReturn: %v", err)
+	}
+
+	//одна оставшаяся штука в TJS и одна в USD (100 центов по курсу 10)
+	localNet, localTax := calcTax(1000, taxRate, false)
+	usdNet, usdTax := calcTax(100, taxRate, false)
+	wantNet := localNet + money.ToBase(money.New(usdNet, "USD"), 10)
+	wantTax := localTax + money.ToBase(money.New(usdTax, "USD"), 10)
+
+	items, err := s.TaxesReport(ctx, from, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("TaxesReport: %v", err)
+	}
+	for _, item := range items {
+		if item.Rate != taxRate {
+			continue
+		}
+		if item.Net != wantNet || item.Tax != wantTax || item.Gross != wantNet+wantTax {
+			t.Errorf("line = %+v, want net %d tax %d", item, wantNet, wantTax)
+		}
+		return
+	}
+	t.Errorf("no line for rate %d", taxRate)
+}
@@ -0,0 +1,95 @@
+package money
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/FaranushKarimov/crud/pkg/types"
+)
+
+//Base ... базовая валюта: в ней хранятся цены товаров и считаются итоги по продажам
+const Base = "TJS"
+
+//minorUnits ... сколько знаков после запятой у валюты (ISO 4217)
+var minorUnits = map[string]int{
+	"TJS": 2,
+	"USD": 2,
+	"EUR": 2,
+	"RUB": 2,
+	"UZS": 2,
+	"KZT": 2,
+	"KGS": 2,
+	"CNY": 2,
+	"GBP": 2,
+	"JPY": 0,
+	"KRW": 0,
+}
+
+//Money ... сумма в минимальных единицах валюты (дирамы, центы) и ISO код валюты
+type Money struct {
+	Amount   int    `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+//New ...
+func New(amount int, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+//Normalize ... приводит код валюты к верхнему регистру, пустой код означает базовую валюту
+func Normalize(currency string) (string, error) {
+	if currency == "" {
+		return Base, nil
+	}
+	currency = strings.ToUpper(currency)
+	if _, ok := minorUnits[currency]; !ok {
+		return "", types.ErrUnknownCurrency
+	}
+	return currency, nil
+}
+
+//FromBase ... переводит сумму в базовой валюте в currency по курсу rate
+//(rate - сколько единиц базовой валюты стоит одна единица currency)
+func FromBase(amount int, currency string, rate float64) Money {
+	if currency == Base {
+		return New(amount, currency)
+	}
+	scale := math.Pow10(minorUnits[currency] - minorUnits[Base])
+	return New(int(math.Round(float64(amount)*scale/rate)), currency)
+}
+
+//ToBase ... обратный перевод в базовую валюту
+func ToBase(m Money, rate float64) int {
+	if m.Currency == Base {
+		return m.Amount
+	}
+	scale := math.Pow10(minorUnits[Base] - minorUnits[m.Currency])
+	return int(math.Round(float64(m.Amount) * scale * rate))
+}
+
+//String ... 1250 TJS -> "12.50 TJS"
+func (m Money) String() string {
+	units := minorUnits[m.Currency]
+	if units == 0 {
+		return fmt.Sprintf("%d %s", m.Amount, m.Currency)
+	}
+	sign, amount := "", m.Amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	div := int(math.Pow10(units))
+	return fmt.Sprintf("%s%d.%0*d %s", sign, amount/div, units, amount%div, m.Currency)
+}
+
+//UnmarshalJSON ... для совместимости со старыми клиентами принимаем и просто число (сумма без валюты)
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var amount int
+	if err := json.Unmarshal(data, &amount); err == nil {
+		*m = Money{Amount: amount}
+		return nil
+	}
+	type plain Money
+	return json.Unmarshal(data, (*plain)(m))
+}
@@ -0,0 +1,112 @@
+package money
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestFromBase(t *testing.T) {
+	tests := []struct {
+		amount   int
+		currency string
+		rate     float64
+		want     int
+	}{
+		{10000, Base, 1, 10000},
+		{10000, "USD", 10.95, 913},
+		{10000, "JPY", 0.073, 1370},
+		{10000, "KRW", 0.0079, 12658},
+		{-10000, "USD", 10.95, -913},
+	}
+	for _, tt := range tests {
+		got := FromBase(tt.amount, tt.currency, tt.rate)
+		if got.Amount != tt.want || got.Currency != tt.currency {
+			t.Errorf("FromBase(%d, %s, %v) = %v, want %d %s", tt.amount, tt.currency, tt.rate, got, tt.want, tt.currency)
+		}
+	}
+}
+
+func TestToBase(t *testing.T) {
+	tests := []struct {
+		money Money
+		rate  float64
+		want  int
+	}{
+		{New(10000, Base), 10.95, 10000},
+		{New(913, "USD"), 10.95, 9997},
+		{New(1370, "JPY"), 0.073, 10001},
+		{New(12658, "KRW"), 0.0079, 10000},
+	}
+	for _, tt := range tests {
+		if got := ToBase(tt.money, tt.rate); got != tt.want {
+			t.Errorf("ToBase(%v, %v) = %d, want %d", tt.money, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestRoundTripWithinMinorUnit(t *testing.T) {
+	//обратный перевод теряет не больше половины минимальной единицы валюты продажи
+	for _, tt := range []struct {
+		currency string
+		rate     float64
+	}{
+		{"USD", 10.9473},
+		{"JPY", 0.0731},
+		{"RUB", 0.1187},
+	} {
+		for _, amount := range []int{1, 99, 123456, 98765432} {
+			back := ToBase(FromBase(amount, tt.currency, tt.rate), tt.rate)
+			unit := tt.rate * math.Pow10(minorUnits[Base]-minorUnits[tt.currency])
+			if math.Abs(float64(back-amount)) > unit/2 {
+				t.Errorf("%d -> %s at %v -> %d, off by more than %v", amount, tt.currency, tt.rate, back, unit/2)
+			}
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{New(1250, "TJS"), "12.50 TJS"},
+		{New(5, "USD"), "0.05 USD"},
+		{New(0, "EUR"), "0.00 EUR"},
+		{New(-1250, "TJS"), "-12.50 TJS"},
+		{New(-5, "USD"), "-0.05 USD"},
+		{New(1370, "JPY"), "1370 JPY"},
+		{New(-1370, "KRW"), "-1370 KRW"},
+	}
+	for _, tt := range tests {
+		if got := tt.money.String(); got != tt.want {
+			t.Errorf("%#v.String() = %q, want %q", tt.money, got, tt.want)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		data string
+		want Money
+	}{
+		{`1250`, Money{Amount: 1250}},
+		{`{"amount": 1250, "currency": "USD"}`, New(1250, "USD")},
+		{`{"amount": 700}`, Money{Amount: 700}},
+	}
+	for _, tt := range tests {
+		var got Money
+		if err := json.Unmarshal([]byte(tt.data), &got); err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.data, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Unmarshal(%s) = %#v, want %#v", tt.data, got, tt.want)
+		}
+	}
+
+	var got Money
+	if err := json.Unmarshal([]byte(`"12.50"`), &got); err == nil {
+		t.Errorf("Unmarshal(string) = %#v, want error", got)
+	}
+}
@@ -0,0 +1,153 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+//размеры страницы A4 в пунктах, поля и шрифт
+const (
+	pageWidth  = 595
+	pageHeight = 842
+	margin     = 40
+	fontSize   = 10
+	leading    = 12
+)
+
+//LinesPerPage ... сколько строк помещается на странице
+const LinesPerPage = (pageHeight - 2*margin) / leading
+
+//Document ... PDF из строк моноширинного текста встроенным шрифтом Courier (без внешних файлов шрифтов);
+//страницы переносятся сами, строка "\f" начинает новую страницу
+type Document struct {
+	Title string
+	text  bytes.Buffer
+}
+
+//New ...
+func New(title string) *Document {
+	return &Document{Title: title}
+}
+
+//Write ... добавляет текст (удобно для вывода text/template), на строки он разбивается при записи PDF
+func (d *Document) Write(p []byte) (int, error) {
+	return d.text.Write(p)
+}
+
+//WriteTo ... пишет готовый PDF
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	pages := d.pages()
+
+	buf := &bytes.Buffer{}
+	offsets := make([]int, 0)
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, len(pages))
+	for i := range pages {
+		//у каждой страницы два объекта: сама страница и её содержимое, первые 4 объекта служебные
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	object(fmt.Sprintf("<< /Title (%s) /Producer (crud) >>", escape(d.Title)))
+
+	for i, page := range pages {
+		stream := &bytes.Buffer{}
+		fmt.Fprintf(stream, "BT /F1 %d Tf %d TL %d %d Td\n", fontSize, leading, margin, pageHeight-margin-fontSize)
+		for _, line := range page {
+			fmt.Fprintf(stream, "(%s) Tj T*\n", escape(line))
+		}
+		stream.WriteString("ET")
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", stream.Len(), stream.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R /Info 4 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return buf.WriteTo(w)
+}
+
+//pages ... режет строки на страницы
+func (d *Document) pages() [][]string {
+	text := strings.TrimSuffix(strings.Replace(d.text.String(), "\r\n", "\n", -1), "\n")
+	pages := [][]string{{}}
+	for _, line := range strings.Split(text, "\n") {
+		last := len(pages) - 1
+		if line == "\f" {
+			pages = append(pages, []string{})
+			continue
+		}
+		if len(pages[last]) == LinesPerPage {
+			pages = append(pages, []string{})
+			last++
+		}
+		pages[last] = append(pages[last], line)
+	}
+	return pages
+}
+
+//Translit ... кириллица латиницей, как она будет напечатана встроенным шрифтом
+//(нужно чтобы выравнивать текст по ширине до записи PDF)
+func Translit(s string) string {
+	out := &strings.Builder{}
+	for _, r := range s {
+		if latin, ok := translit[r]; ok {
+			out.WriteString(latin)
+			continue
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
+//escape ... кодирует строку в WinAnsi для встроенного шрифта: кириллица транслитерируется,
+//остальные символы вне Latin-1 заменяются на "?"
+func escape(s string) string {
+	out := &strings.Builder{}
+	for _, r := range s {
+		if latin, ok := translit[r]; ok {
+			out.WriteString(latin)
+			continue
+		}
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case r == '\t':
+			out.WriteString("    ")
+		case r >= 0x20 && r < 0x7f:
+			out.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(out, "\\%03o", r)
+		default:
+			out.WriteByte('?')
+		}
+	}
+	return out.String()
+}
+
+var translit = map[rune]string{
+	'А': "A", 'Б': "B", 'В': "V", 'Г': "G", 'Д': "D", 'Е': "E", 'Ё': "Yo", 'Ж': "Zh", 'З': "Z", 'И': "I",
+	'Й': "Y", 'К': "K", 'Л': "L", 'М': "M", 'Н': "N", 'О': "O", 'П': "P", 'Р': "R", 'С': "S", 'Т': "T",
+	'У': "U", 'Ф': "F", 'Х': "Kh", 'Ц': "Ts", 'Ч': "Ch", 'Ш': "Sh", 'Щ': "Shch", 'Ъ': "", 'Ы': "Y", 'Ь': "",
+	'Э': "E", 'Ю': "Yu", 'Я': "Ya", 'Ғ': "Gh", 'Ӣ': "I", 'Қ': "Q", 'Ӯ': "U", 'Ҳ': "H", 'Ҷ': "J",
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh", 'з': "z", 'и': "i",
+	'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t",
+	'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "",
+	'э': "e", 'ю': "yu", 'я': "ya", 'ғ': "gh", 'ӣ': "i", 'қ': "q", 'ӯ': "u", 'ҳ': "h", 'ҷ': "j",
+	'№': "No", '—': "-", '–': "-", '«': "\"", '»': "\"",
+}
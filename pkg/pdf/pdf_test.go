@@ -0,0 +1,79 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWriteToXrefPointsAtObjects(t *testing.T) {
+	doc := New("Чек (тест)")
+	for i := 0; i < LinesPerPage+5; i++ {
+		fmt.Fprintf(doc, "строка %d (скобки) \\ №\n", i)
+	}
+	doc.Write([]byte("\f\nпоследняя страница\n"))
+
+	out := &bytes.Buffer{}
+	if _, err := doc.WriteTo(out); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	data := out.Bytes()
+
+	match := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(data)
+	if match == nil {
+		t.Fatal("no startxref at the end of file")
+	}
+	xref, _ := strconv.Atoi(string(match[1]))
+	if !bytes.HasPrefix(data[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at xref table", xref)
+	}
+
+	lines := strings.Split(string(data[xref:]), "\n")
+	var first, count int
+	if _, err := fmt.Sscanf(lines[1], "%d %d", &first, &count); err != nil {
+		t.Fatalf("xref subsection %q: %v", lines[1], err)
+	}
+	//каталог, дерево страниц, шрифт, info и по два объекта на каждую из 3 страниц
+	if first != 0 || count != 4+2*3+1 {
+		t.Fatalf("xref subsection = %d %d, want 0 %d", first, count, 4+2*3+1)
+	}
+	for n := 1; n < count; n++ {
+		entry := lines[2+n]
+		if len(entry) != 19 || !strings.HasSuffix(entry, " 00000 n ") {
+			t.Fatalf("xref entry %d = %q, want 20-byte in-use entry", n, entry)
+		}
+		offset, _ := strconv.Atoi(entry[:10])
+		if want := fmt.Sprintf("%d 0 obj\n", n); !bytes.HasPrefix(data[offset:], []byte(want)) {
+			t.Errorf("object %d at offset %d starts with %q", n, offset, data[offset:offset+len(want)])
+		}
+	}
+}
+
+func TestWriteToStreamLength(t *testing.T) {
+	doc := New("test")
+	doc.Write([]byte("Привет, (мир)\n\f\nвторая\n"))
+
+	out := &bytes.Buffer{}
+	if _, err := doc.WriteTo(out); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	data := out.Bytes()
+
+	streams := regexp.MustCompile(`<< /Length (\d+) >>\nstream\n`).FindAllSubmatchIndex(data, -1)
+	if len(streams) != 2 {
+		t.Fatalf("streams = %d, want 2", len(streams))
+	}
+	for _, stream := range streams {
+		length, _ := strconv.Atoi(string(data[stream[2]:stream[3]]))
+		body := data[stream[1]:]
+		if !bytes.HasPrefix(body[length:], []byte("\nendstream")) {
+			t.Errorf("/Length %d does not end at endstream: %q", length, body[:length+10])
+		}
+	}
+	if !bytes.Contains(data, []byte(`(Privet, \(mir\)) Tj`)) {
+		t.Error("text is not transliterated and escaped")
+	}
+}
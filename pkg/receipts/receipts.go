@@ -0,0 +1,269 @@
+package receipts
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/FaranushKarimov/crud/pkg/managers"
+	"github.com/FaranushKarimov/crud/pkg/money"
+	"github.com/FaranushKarimov/crud/pkg/pdf"
+)
+
+//Width ... ширина текстового чека в символах
+const Width = 64
+
+//Shop ... реквизиты магазина, которые печатаются в чеке и счете
+type Shop struct {
+	Name    string
+	Address string
+	Phone   string
+	TaxID   string
+	Bank    string
+	Account string
+}
+
+//ShopFromEnv ... реквизиты из переменных окружения SHOP_NAME, SHOP_ADDRESS, SHOP_PHONE,
+//SHOP_TAX_ID, SHOP_BANK и SHOP_ACCOUNT
+func ShopFromEnv() *Shop {
+	return &Shop{
+		Name:    os.Getenv("SHOP_NAME"),
+		Address: os.Getenv("SHOP_ADDRESS"),
+		Phone:   os.Getenv("SHOP_PHONE"),
+		TaxID:   os.Getenv("SHOP_TAX_ID"),
+		Bank:    os.Getenv("SHOP_BANK"),
+		Account: os.Getenv("SHOP_ACCOUNT"),
+	}
+}
+
+//Data ... всё что нужно для печати; Customer может быть nil (покупатель без карточки)
+type Data struct {
+	Shop     *Shop
+	Document *managers.Document
+	Sale     *managers.Sale
+	Customer *managers.Customer
+}
+
+//Title ... "Чек № 000042"
+func (d *Data) Title() string {
+	return fmt.Sprintf("%s № %06d", titles[d.Document.Kind], d.Document.Number)
+}
+
+var titles = map[string]string{
+	managers.DocumentReceipt: "Чек",
+	managers.DocumentInvoice: "Счет",
+}
+
+var paymentMethods = map[string]string{
+	managers.PaymentCash:        "Наличные",
+	managers.PaymentCard:        "Карта",
+	managers.PaymentTransfer:    "Перевод",
+	managers.PaymentStoreCredit: "Баланс покупателя",
+	managers.PaymentLoyalty:     "Баллы",
+}
+
+var funcs = map[string]interface{}{
+	"money": func(amount int, currency string) string {
+		return money.New(amount, currency).String()
+	},
+	"percent": func(rate int) string {
+		return fmt.Sprintf("%d.%02d%%", rate/100, rate%100)
+	},
+	"date": func(t time.Time) string {
+		return t.Format("02.01.2006 15:04")
+	},
+	"add": func(a, b int) int {
+		return a + b
+	},
+	"method": func(method string) string {
+		if name, ok := paymentMethods[method]; ok {
+			return name
+		}
+		return method
+	},
+	"row":    row,
+	"center": center,
+	"line": func() string {
+		return strings.Repeat("-", Width)
+	},
+}
+
+//textFuncs ... в PDF кириллица печатается латиницей другой длины, поэтому выравниваем уже транслитерированный текст
+var textFuncs = map[string]interface{}{
+	"row": func(left, right string) string {
+		return row(pdf.Translit(left), pdf.Translit(right))
+	},
+	"center": func(s string) string {
+		return center(pdf.Translit(s))
+	},
+}
+
+//HTML ... документ для показа в браузере и печати
+func HTML(w io.Writer, data *Data) error {
+	return htmlTemplates.ExecuteTemplate(w, data.Document.Kind, data)
+}
+
+//PDF ... тот же документ в PDF: текстовый шаблон раскладывается моноширинным шрифтом
+func PDF(w io.Writer, data *Data) error {
+	doc := pdf.New(data.Title())
+	if err := textTemplates.ExecuteTemplate(doc, data.Document.Kind, data); err != nil {
+		return err
+	}
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+//row ... левая и правая часть строки, выровненные по краям чека
+func row(left, right string) string {
+	space := Width - utf8.RuneCountInString(left) - utf8.RuneCountInString(right)
+	if space < 1 {
+		space = 1
+	}
+	return left + strings.Repeat(" ", space) + right
+}
+
+func center(s string) string {
+	space := (Width - utf8.RuneCountInString(s)) / 2
+	if space < 0 {
+		space = 0
+	}
+	return strings.Repeat(" ", space) + s
+}
+
+var textTemplates = template.Must(template.New("text").Funcs(funcs).Funcs(textFuncs).Parse(`
+{{- define "header"}}{{center .Shop.Name}}
+{{center .Shop.Address}}
+{{center (printf "Тел.: %s  ИНН: %s" .Shop.Phone .Shop.TaxID)}}
+{{line}}
+{{row .Title (date .Document.Created)}}
+{{row (printf "Продажа #%d" .Sale.ID) (date .Sale.Created)}}
+{{- if .Customer}}
+{{row "Покупатель" .Customer.Name}}
+{{- end}}
+{{line}}
+{{range .Sale.Positions}}{{.ProductName}}
+{{row (printf "  %d x %s" .Qty (money .Price.Amount .Price.Currency)) (money (add .Net .Tax) .Price.Currency)}}
+{{- if .Discount}}
+{{row "  скидка" (printf "-%s" (money .Discount .Price.Currency))}}
+{{- end}}
+{{- if .Returned}}
+{{row "  возвращено, шт." (printf "%d" .Returned)}}
+{{- end}}
+{{end}}{{line}}
+{{- if .Sale.Coupon}}
+{{row (printf "Купон %s" .Sale.Coupon) (printf "-%s" (money .Sale.CouponDiscount .Sale.Currency))}}
+{{- end}}
+{{- range .Sale.Taxes}}
+{{row (printf "в т.ч. налог %s" (percent .Rate)) (money .Tax $.Sale.Currency)}}
+{{- end}}
+{{row "ИТОГО" (money .Sale.Total .Sale.Currency)}}
+{{- end}}
+
+{{- define "receipt"}}{{template "header" .}}
+{{- range .Sale.Payments}}
+{{row (method .Method) (money .Amount $.Sale.Currency)}}
+{{- if .Change}}
+{{row "  сдача" (money .Change $.Sale.Currency)}}
+{{- end}}
+{{- end}}
+{{- if .Sale.Balance}}
+{{row "Остаток к оплате" (money .Sale.Balance .Sale.Currency)}}
+{{- end}}
+{{- if .Sale.Refunded}}
+{{row "Возвращено" (money .Sale.Refunded .Sale.Currency)}}
+{{- end}}
+{{line}}
+{{center "Спасибо за покупку!"}}
+{{end}}
+
+{{- define "invoice"}}{{template "header" .}}
+{{row "Оплачено" (money .Sale.PaymentsTotal .Sale.Currency)}}
+{{row "К оплате" (money .Sale.Balance .Sale.Currency)}}
+{{line}}
+Получатель: {{.Shop.Name}}, ИНН {{.Shop.TaxID}}
+Банк: {{.Shop.Bank}}
+Счет: {{.Shop.Account}}
+{{end}}
+`))
+
+var htmlTemplates = htmltemplate.Must(htmltemplate.New("html").Funcs(funcs).Parse(`
+{{- define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 720px; margin: 24px auto; }
+table { width: 100%; border-collapse: collapse; }
+th, td { padding: 4px 6px; border-bottom: 1px solid #ddd; text-align: left; }
+td.num, th.num { text-align: right; }
+.shop { text-align: center; }
+</style>
+</head>
+<body>
+<div class="shop">
+<h2>{{.Shop.Name}}</h2>
+<div>{{.Shop.Address}}</div>
+<div>Тел.: {{.Shop.Phone}} &middot; ИНН: {{.Shop.TaxID}}</div>
+</div>
+<h3>{{.Title}} от {{date .Document.Created}}</h3>
+<p>Продажа #{{.Sale.ID}} от {{date .Sale.Created}}{{if .Customer}}, покупатель: {{.Customer.Name}}{{end}}</p>
+<table>
+<tr><th>Товар</th><th class="num">Кол-во</th><th class="num">Цена</th><th class="num">Скидка</th><th class="num">Налог</th><th class="num">Сумма</th></tr>
+{{- range .Sale.Positions}}
+<tr>
+<td>{{.ProductName}}{{if .Returned}} (возвращено {{.Returned}} шт.){{end}}</td>
+<td class="num">{{.Qty}}</td>
+<td class="num">{{money .Price.Amount .Price.Currency}}</td>
+<td class="num">{{if .Discount}}-{{money .Discount .Price.Currency}}{{end}}</td>
+<td class="num">{{percent .TaxRate}}</td>
+<td class="num">{{money (add .Net .Tax) .Price.Currency}}</td>
+</tr>
+{{- end}}
+</table>
+<table>
+{{- if .Sale.Coupon}}
+<tr><td>Купон {{.Sale.Coupon}}</td><td class="num">-{{money .Sale.CouponDiscount .Sale.Currency}}</td></tr>
+{{- end}}
+{{- range .Sale.Taxes}}
+<tr><td>в т.ч. налог {{percent .Rate}}</td><td class="num">{{money .Tax $.Sale.Currency}}</td></tr>
+{{- end}}
+<tr><th>ИТОГО</th><th class="num">{{money .Sale.Total .Sale.Currency}}</th></tr>
+</table>
+{{- end}}
+
+{{- define "receipt"}}{{template "header" .}}
+<table>
+{{- range .Sale.Payments}}
+<tr><td>{{method .Method}}</td><td class="num">{{money .Amount $.Sale.Currency}}</td></tr>
+{{- if .Change}}
+<tr><td>сдача</td><td class="num">{{money .Change $.Sale.Currency}}</td></tr>
+{{- end}}
+{{- end}}
+{{- if .Sale.Balance}}
+<tr><th>Остаток к оплате</th><th class="num">{{money .Sale.Balance .Sale.Currency}}</th></tr>
+{{- end}}
+{{- if .Sale.Refunded}}
+<tr><td>Возвращено</td><td class="num">{{money .Sale.Refunded .Sale.Currency}}</td></tr>
+{{- end}}
+</table>
+<p class="shop">Спасибо за покупку!</p>
+</body>
+</html>
+{{end}}
+
+{{- define "invoice"}}{{template "header" .}}
+<table>
+<tr><td>Оплачено</td><td class="num">{{money .Sale.PaymentsTotal .Sale.Currency}}</td></tr>
+<tr><th>К оплате</th><th class="num">{{money .Sale.Balance .Sale.Currency}}</th></tr>
+</table>
+<p>Получатель: {{.Shop.Name}}, ИНН {{.Shop.TaxID}}<br>Банк: {{.Shop.Bank}}<br>Счет: {{.Shop.Account}}</p>
+</body>
+</html>
+{{end}}
+`))
@@ -0,0 +1,103 @@
+package receipts
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FaranushKarimov/crud/pkg/managers"
+	"github.com/FaranushKarimov/crud/pkg/money"
+)
+
+//testData ... продажа с купоном, налогом, возвратом, сдачей и без карточки покупателя
+func testData(kind string) *Data {
+	created := time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+	return &Data{
+		Shop:     &Shop{Name: "Магазин", Address: "Душанбе", Phone: "+992", TaxID: "123", Bank: "Банк", Account: "40702"},
+		Document: &managers.Document{ID: 1, SaleID: 42, Kind: kind, Number: 7, Created: created},
+		Sale: &managers.Sale{
+			ID:             42,
+			Currency:       money.Base,
+			Coupon:         "SPRING",
+			CouponDiscount: 500,
+			Tax:            3000,
+			Total:          18000,
+			Refunded:       6000,
+			PaymentsTotal:  18000,
+			Created:        created,
+			Positions: []*managers.SalePosition{{
+				ProductName: "Чай",
+				Price:       money.New(10000, money.Base),
+				Qty:         2,
+				Returned:    1,
+				Discount:    1500,
+				TaxRate:     2000,
+				Net:         15000,
+				Tax:         3000,
+			}},
+			Taxes: []*managers.TaxLine{{Rate: 2000, Net: 15000, Tax: 3000, Gross: 18000}},
+			Payments: []*managers.Payment{
+				{Method: managers.PaymentLoyalty, Amount: 3000},
+				{Method: managers.PaymentCash, Amount: 15000, Tendered: 20000, Change: 5000},
+			},
+		},
+	}
+}
+
+func TestHTML(t *testing.T) {
+	for _, kind := range []string{managers.DocumentReceipt, managers.DocumentInvoice} {
+		out := &bytes.Buffer{}
+		if err := HTML(out, testData(kind)); err != nil {
+			t.Fatalf("%s: HTML: %v", kind, err)
+		}
+		html := out.String()
+		for _, want := range []string{"Купон SPRING", "в т.ч. налог 20.00%", "возвращено 1 шт.", "ИТОГО"} {
+			if !strings.Contains(html, want) {
+				t.Errorf("%s: no %q in HTML", kind, want)
+			}
+		}
+		if strings.Contains(html, "покупатель:") {
+			t.Errorf("%s: customer printed for anonymous sale", kind)
+		}
+	}
+}
+
+func TestReceiptText(t *testing.T) {
+	out := &bytes.Buffer{}
+	if err := PDF(out, testData(managers.DocumentReceipt)); err != nil {
+		t.Fatalf("PDF: %v", err)
+	}
+	doc := out.String()
+	if !strings.HasPrefix(doc, "%PDF-1.4\n") || !strings.HasSuffix(doc, "%%EOF\n") {
+		t.Fatal("output is not a complete PDF")
+	}
+	for _, want := range []string{"Chek No 000007", "Kupon SPRING", "Bally", "  sdacha", "Vozvrashcheno", "ITOGO"} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("no %q in receipt", want)
+		}
+	}
+	if strings.Contains(doc, "Pokupatel") {
+		t.Error("customer printed for anonymous sale")
+	}
+}
+
+func TestInvoiceText(t *testing.T) {
+	out := &bytes.Buffer{}
+	if err := PDF(out, testData(managers.DocumentInvoice)); err != nil {
+		t.Fatalf("PDF: %v", err)
+	}
+	doc := out.String()
+	for _, want := range []string{"Schet No 000007", "Oplacheno", "K oplate", "Poluchatel: Magazin, INN 123"} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("no %q in invoice", want)
+		}
+	}
+}
+
+func TestRowAlignsToWidth(t *testing.T) {
+	line := row("ИТОГО", "180.00 TJS")
+	if got := len([]rune(line)); got != Width {
+		t.Errorf("row width = %d, want %d", got, Width)
+	}
+}
@@ -2,6 +2,8 @@ package types
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
 )
 
 var (
@@ -19,4 +21,110 @@ var (
 	ErrPhoneUsed = errors.New("phone alredy registered")
 	//ErrTokenExpired ...
 	ErrTokenExpired = errors.New("token expired")
+	//ErrInvalidPromotion ...
+	ErrInvalidPromotion = errors.New("invalid promotion")
+	//ErrInvalidCoupon ...
+	ErrInvalidCoupon = errors.New("coupon is invalid, expired or used up")
+	//ErrCouponCodeUsed ...
+	ErrCouponCodeUsed = errors.New("coupon code already exists")
+	//ErrInvalidTaxRate ...
+	ErrInvalidTaxRate = errors.New("invalid tax rate")
+	//ErrUnknownCurrency ...
+	ErrUnknownCurrency = errors.New("unknown currency")
+	//ErrCurrencyMismatch ...
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	//ErrNoExchangeRate ...
+	ErrNoExchangeRate = errors.New("no exchange rate for currency")
+	//ErrInvalidAttributes ...
+	ErrInvalidAttributes = errors.New("invalid product attributes")
+	//ErrInvalidImage ...
+	ErrInvalidImage = errors.New("invalid image")
+	//ErrInvalidPosition ...
+	ErrInvalidPosition = errors.New("invalid sale position")
+	//ErrOutOfStock ...
+	ErrOutOfStock = errors.New("not enough products in stock")
+	//ErrOverrideReason ...
+	ErrOverrideReason = errors.New("price override requires a reason")
+	//ErrOverrideForbidden ...
+	ErrOverrideForbidden = errors.New("price override is not permitted")
+	//ErrInvalidReturn ...
+	ErrInvalidReturn = errors.New("invalid return")
+	//ErrReturnExceedsSold ...
+	ErrReturnExceedsSold = errors.New("return qty exceeds sold qty")
+	//ErrInvalidStatus ...
+	ErrInvalidStatus = errors.New("invalid sale status")
+	//ErrSaleStatus ...
+	ErrSaleStatus = errors.New("operation is not allowed in current sale status")
+	//ErrInvalidPayment ...
+	ErrInvalidPayment = errors.New("invalid payment")
+	//ErrOverpayment ...
+	ErrOverpayment = errors.New("payment exceeds outstanding balance")
+	//ErrInsufficientCredit ...
+	ErrInsufficientCredit = errors.New("not enough store credit")
+	//ErrBalanceDue ...
+	ErrBalanceDue = errors.New("sale has outstanding balance")
+	//ErrSaleHasPayments ...
+	ErrSaleHasPayments = errors.New("sale has payments")
+	//ErrInvalidDocument ...
+	ErrInvalidDocument = errors.New("invalid document kind or format")
+	//ErrInvalidPlan ...
+	ErrInvalidPlan = errors.New("invalid plan")
+	//ErrInvalidCommission ...
+	ErrInvalidCommission = errors.New("invalid commission scheme")
+	//ErrInvalidPeriod ...
+	ErrInvalidPeriod = errors.New("invalid period")
+	//ErrPayrollLocked ...
+	ErrPayrollLocked = errors.New("payroll run is locked")
+	//ErrInvalidReport ...
+	ErrInvalidReport = errors.New("invalid report parameters")
+	//ErrIdempotencyMismatch ...
+	ErrIdempotencyMismatch = errors.New("idempotency key was used with a different request")
+	//ErrIdempotencyInProgress ...
+	ErrIdempotencyInProgress = errors.New("request with this idempotency key is in progress")
+	//ErrCartEmpty ...
+	ErrCartEmpty = errors.New("cart is empty")
+	//ErrCartChanged ...
+	ErrCartChanged = errors.New("cart prices or stock have changed")
+	//ErrNoManagers ...
+	ErrNoManagers = errors.New("no active managers to take the order")
+	//ErrInvalidLoyaltyRate ...
+	ErrInvalidLoyaltyRate = errors.New("invalid loyalty rate")
+	//ErrInsufficientPoints ...
+	ErrInsufficientPoints = errors.New("not enough loyalty points")
+	//ErrCustomerRequired ...
+	ErrCustomerRequired = errors.New("customer_id is required, set anonymous for a walk-in sale")
+	//ErrCustomerNotFound ...
+	ErrCustomerNotFound = errors.New("sale customer does not exist")
+	//ErrCustomerInactive ...
+	ErrCustomerInactive = errors.New("sale customer is inactive")
+	//ErrAnonymousCustomer ...
+	ErrAnonymousCustomer = errors.New("anonymous sale cannot have a customer")
+	//ErrCustomerInUse ...
+	ErrCustomerInUse = errors.New("customer has sales or loyalty history and cannot be removed")
+	//ErrInvalidBoss ...
+	ErrInvalidBoss = errors.New("boss does not exist or is inactive")
+	//ErrHierarchyCycle ...
+	ErrHierarchyCycle = errors.New("manager cannot report to themselves or their subordinate")
+	//ErrInvalidDepartment ...
+	ErrInvalidDepartment = errors.New("invalid department")
+	//ErrDepartmentNameUsed ...
+	ErrDepartmentNameUsed = errors.New("department name already exists")
 )
+
+//StoredResponse ... сохраненный ответ на запрос с Idempotency-Key вместе с заголовками
+type StoredResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+//ConflictError ... запись уже изменена кем-то другим (версия не совпала)
+type ConflictError struct {
+	Entity  string
+	ID      int64
+	Version int64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s %d: version conflict, current version is %d", e.Entity, e.ID, e.Version)
+}
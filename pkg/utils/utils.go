@@ -18,3 +18,20 @@ func GenerateTokenStr() (string, error) {
 
 	return hex.EncodeToString(buffer), nil
 }
+
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+//GenerateCode ... случайный код из n символов без похожих друг на друга букв и цифр (O/0, I/1)
+func GenerateCode(n int) (string, error) {
+
+	buffer := make([]byte, n)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", types.ErrInternal
+	}
+
+	for i, b := range buffer {
+		buffer[i] = codeAlphabet[int(b)%len(codeAlphabet)]
+	}
+
+	return string(buffer), nil
+}